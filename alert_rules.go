@@ -0,0 +1,639 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Alert rule types.
+const (
+	ruleThreshold     = "threshold"      // rate at or beyond Min/Max
+	rulePercentChange = "percent_change" // rate moved by Percent within Window
+	ruleNewHigh       = "new_high"       // highest rate in the last Days days
+	ruleNewLow        = "new_low"        // lowest rate in the last Days days
+	ruleMACross       = "ma_cross"       // rate crossed its moving average over Window
+	ruleStale         = "stale"          // no successful fetch within Window
+	ruleBestProvider  = "best_provider"  // a competitor beats CIMB by Spread, or the best provider changed
+)
+
+// AlertRule is one configured alert. Rules are evaluated against the stored
+// rate history after every successful fetch of their pair; stale rules are
+// evaluated on every tick instead, since a failing fetch is what they catch,
+// and best_provider rules after the providers have been compared.
+type AlertRule struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Pair string `json:"pair"`
+
+	// Min and Max bound a threshold rule and are set together. When both are
+	// zero the pair's own desired range is used, so changes made at runtime
+	// apply.
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+
+	// Percent is the change a percent_change rule looks for: positive for a
+	// rise of at least Percent, negative for a fall of at least -Percent.
+	Percent float64 `json:"percent,omitempty"`
+
+	// Window is the look-back for percent_change, the averaging period for
+	// ma_cross, and the maximum data age for stale.
+	Window Duration `json:"window,omitempty"`
+
+	// Days is the look-back for new_high and new_low.
+	Days int `json:"days,omitempty"`
+
+	// Spread is how much more of the To currency the best competitor must
+	// give than CIMB for a transfer of Amount (the transfer amount when
+	// zero) before a best_provider rule fires. With OnChange it also fires
+	// whenever the best provider changes.
+	Spread   float64 `json:"spread,omitempty"`
+	Amount   float64 `json:"amount,omitempty"`
+	OnChange bool    `json:"on_change,omitempty"`
+
+	// Message is a text/template for the alert text; see alertData for the
+	// available fields. Each type has a default. MessageFile names a file
+	// holding the template instead, relative to the config file.
+	Message     string `json:"message,omitempty"`
+	MessageFile string `json:"message_file,omitempty"`
+
+	// Targets override the default WhatsApp targets for this rule. Target
+	// is a shorthand for a single one.
+	Target  string   `json:"target,omitempty"`
+	Targets []string `json:"targets,omitempty"`
+
+	// Cooldown is the minimum time between two alerts from this rule.
+	Cooldown Duration `json:"cooldown,omitempty"`
+
+	// Hysteresis is how far back inside its range a threshold rule's rate
+	// must move before the rule re-arms. Other rules re-arm as soon as their
+	// condition stops holding.
+	Hysteresis float64 `json:"hysteresis,omitempty"`
+
+	// MaxPerDay caps the alerts this rule sends per local calendar day.
+	MaxPerDay int `json:"max_per_day,omitempty"`
+
+	// Urgent alerts are delivered even during their targets' quiet hours.
+	Urgent bool `json:"urgent,omitempty"`
+
+	tmpl  *template.Template
+	state ruleState
+}
+
+// alertData is what a rule's message template is executed with.
+type alertData struct {
+	Rule     string
+	Type     string
+	Pair     string
+	From     string
+	To       string
+	Rate     float64
+	PrevRate float64
+	// Reference is what the rate was compared with: the threshold crossed,
+	// the rate at the start of the window, the previous high or low, or the
+	// moving average.
+	Reference     float64
+	ChangePercent float64
+	Window        time.Duration
+	Days          int
+
+	// Delta and DeltaPercent are the change from PrevRate (zero when there
+	// is no previous rate).
+	Delta        float64
+	DeltaPercent float64
+	// Threshold and Crossed ("min" or "max") are set when a threshold rule
+	// fires.
+	Threshold float64
+	Crossed   string
+	// DayHigh and DayLow are the extremes of today's rates, including this
+	// one, in the configured timezone.
+	DayHigh float64
+	DayLow  float64
+	// Time is in the configured timezone, named by TimeZone.
+	Time     time.Time
+	TimeZone string
+	// Link is the CIMB page the rate is read from.
+	Link string
+
+	// Set for best_provider rules: the best provider now and at the last
+	// comparison, the best provider other than CIMB with its rate, and how
+	// much more of the To currency it gives than CIMB (negative for less)
+	// for a transfer of Amount, after fees. Rate is CIMB's rate.
+	Provider         string
+	PreviousProvider string
+	Competitor       string
+	CompetitorRate   float64
+	Difference       float64
+
+	// Amount is the transfer amount: a best_provider rule's own, otherwise
+	// the configured one (zero when none is).
+	Amount float64
+	// Received is what Amount gets from CIMB at Rate after fees.
+	Received float64
+	// Yesterday is yesterday's closing rate, zero when unknown.
+	Yesterday float64
+	// ReceivedDelta is the change in Received since Yesterday.
+	ReceivedDelta float64
+}
+
+// messageFuncs are available to message templates, e.g. {{rate .DayHigh}}.
+var messageFuncs = template.FuncMap{
+	"rate":    func(v float64) string { return fmt.Sprintf("%.4f", v) },
+	"percent": func(v float64) string { return fmt.Sprintf("%+.2f%%", v) },
+	"money":   formatMoney,
+	"signed":  formatSignedMoney,
+}
+
+// sampleAlertData is what message templates are tried out with at startup,
+// so a template naming a field that does not exist fails then rather than
+// when the alert fires.
+var sampleAlertData = alertData{
+	Rule: "sample", Type: ruleThreshold, Pair: "SGD/MYR", From: "SGD", To: "MYR",
+	Rate: 3.5, PrevRate: 3.49, Reference: 3.5, Threshold: 3.5, Crossed: "max",
+	DayHigh: 3.5, DayLow: 3.48, Time: time.Unix(0, 0), TimeZone: "UTC",
+	Provider: "Wise", PreviousProvider: "CIMB", Competitor: "Wise", CompetitorRate: 3.51,
+	Difference: 10, Amount: 1000, Received: 3500, Yesterday: 3.49, ReceivedDelta: 10,
+}
+
+// transferLine is added to the default messages of rate rules: what the
+// configured transfer amount gets, when one is configured.
+const transferLine = `{{if .Amount}}
+{{.From}} {{money .Amount}} = {{.To}} {{money .Received}}{{if .Yesterday}} ({{signed .ReceivedDelta}} vs yesterday){{end}}{{end}}`
+
+var defaultRuleMessages = map[string]string{
+	ruleThreshold:     `Alert: The current rate is {{.From}} 1.00 = {{.To}} {{printf "%.4f" .Rate}}` + transferLine,
+	rulePercentChange: `Alert: {{.Pair}} moved {{printf "%+.2f" .ChangePercent}}% in {{.Window}} to {{printf "%.4f" .Rate}}` + transferLine,
+	ruleNewHigh:       `Alert: {{.Pair}} is at a new {{.Days}}-day high of {{printf "%.4f" .Rate}} (previous high {{printf "%.4f" .Reference}})` + transferLine,
+	ruleNewLow:        `Alert: {{.Pair}} is at a new {{.Days}}-day low of {{printf "%.4f" .Rate}} (previous low {{printf "%.4f" .Reference}})` + transferLine,
+	ruleMACross:       `Alert: {{.Pair}} crossed its {{.Window}} moving average of {{printf "%.4f" .Reference}}, now {{printf "%.4f" .Rate}}` + transferLine,
+	ruleStale:         `Alert: no {{.Pair}} rate fetched for over {{.Window}}`,
+	ruleBestProvider:  `Alert: {{.Provider}} now has the best {{.Pair}} rate. For {{.From}} {{printf "%.2f" .Amount}}, {{.Competitor}} gives {{printf "%+.2f" .Difference}} {{.To}} compared with CIMB ({{rate .CompetitorRate}} vs {{rate .Rate}})`,
+}
+
+// prepare validates the rule and parses its message template.
+func (r *AlertRule) prepare() error {
+	if r.Name == "" {
+		r.Name = r.Pair + " " + r.Type
+	}
+	if r.Pair == "" {
+		return fmt.Errorf("rule %q: pair is required", r.Name)
+	}
+
+	if r.Target != "" {
+		r.Targets = append([]string{r.Target}, r.Targets...)
+		r.Target = ""
+	}
+
+	if r.Cooldown < 0 || r.Hysteresis < 0 || r.MaxPerDay < 0 {
+		return fmt.Errorf("rule %q: cooldown, hysteresis and max_per_day cannot be negative", r.Name)
+	}
+
+	switch r.Type {
+	case ruleThreshold:
+		if (r.Min == 0) != (r.Max == 0) {
+			return fmt.Errorf("rule %q: set both min and max, or neither to use the pair's range", r.Name)
+		}
+		if r.Max != 0 && r.Max <= r.Min {
+			return fmt.Errorf("rule %q: max must be greater than min", r.Name)
+		}
+	case rulePercentChange:
+		if r.Percent == 0 || r.Window <= 0 {
+			return fmt.Errorf("rule %q: percent_change needs a non-zero percent and a window", r.Name)
+		}
+	case ruleNewHigh, ruleNewLow:
+		if r.Days <= 0 {
+			return fmt.Errorf("rule %q: %s needs days", r.Name, r.Type)
+		}
+	case ruleMACross, ruleStale:
+		if r.Window <= 0 {
+			return fmt.Errorf("rule %q: %s needs a window", r.Name, r.Type)
+		}
+	case ruleBestProvider:
+		if r.Spread < 0 || r.Amount < 0 {
+			return fmt.Errorf("rule %q: spread and amount cannot be negative", r.Name)
+		}
+		if r.Spread == 0 && !r.OnChange {
+			return fmt.Errorf("rule %q: best_provider needs a spread or on_change", r.Name)
+		}
+	default:
+		return fmt.Errorf("rule %q: unknown type %q", r.Name, r.Type)
+	}
+
+	message := r.Message
+	if message == "" {
+		message = defaultRuleMessages[r.Type]
+	}
+	tmpl, err := template.New(r.Name).Funcs(messageFuncs).Parse(message)
+	if err != nil {
+		return fmt.Errorf("rule %q: invalid message template: %v", r.Name, err)
+	}
+	if err := tmpl.Execute(io.Discard, sampleAlertData); err != nil {
+		return fmt.Errorf("rule %q: invalid message template: %v", r.Name, err)
+	}
+	r.tmpl = tmpl
+	return nil
+}
+
+// defaultRules gives every pair a threshold rule on its own desired range,
+// which is how alerts worked before rules were configurable. Derived pairs
+// without a range get none.
+func defaultRules(pairs []*CurrencyPair) ([]*AlertRule, error) {
+	var rules []*AlertRule
+	for _, pair := range pairs {
+		if pair.DesiredMinRate == 0 && pair.DesiredMaxRate == 0 {
+			continue
+		}
+		rule := &AlertRule{Name: pair.Name() + " range", Type: ruleThreshold, Pair: pair.Name()}
+		if err := rule.prepare(); err != nil {
+			return nil, fmt.Errorf("%s: %v", pair.Name(), err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// check reports whether the rule's condition holds for quote and whether the
+// rate has moved far enough back for the rule to re-arm, filling in the
+// template data. prevRate is the pair's previous rate (zero if unknown).
+func (r *AlertRule) check(config *Config, pair *CurrencyPair, quote Quote, prevRate float64) (condition, rearm bool, data alertData, err error) {
+	condition, data, err = r.evaluate(config, pair, quote, prevRate)
+	if err != nil {
+		return false, false, data, err
+	}
+
+	rearm = !condition
+	if r.Type == ruleThreshold && r.Hysteresis > 0 {
+		min, max, err := r.band(config, pair)
+		if err != nil {
+			return false, false, data, err
+		}
+		rearm = quote.Rate > min+r.Hysteresis && quote.Rate < max-r.Hysteresis
+	}
+	return condition, rearm, data, nil
+}
+
+// band returns the range a threshold rule alerts outside of, failing when
+// neither the rule nor its pair has one.
+func (r *AlertRule) band(config *Config, pair *CurrencyPair) (min, max float64, err error) {
+	min, max = r.Min, r.Max
+	if min == 0 && max == 0 {
+		config.mu.RLock()
+		min, max = pair.DesiredMinRate, pair.DesiredMaxRate
+		config.mu.RUnlock()
+	}
+	if max <= min {
+		return 0, 0, fmt.Errorf("%s has no alert range; set min and max", pair.Name())
+	}
+	return min, max, nil
+}
+
+func (r *AlertRule) evaluate(config *Config, pair *CurrencyPair, quote Quote, prevRate float64) (bool, alertData, error) {
+	data := alertData{
+		Rule:     r.Name,
+		Type:     r.Type,
+		Pair:     pair.Name(),
+		From:     pair.From,
+		To:       pair.To,
+		Rate:     quote.Rate,
+		PrevRate: prevRate,
+		Window:   time.Duration(r.Window),
+		Days:     r.Days,
+		Time:     quote.Timestamp,
+	}
+	// History before this quote, which has already been recorded.
+	before := quote.Timestamp.Add(-time.Millisecond)
+
+	switch r.Type {
+	case ruleThreshold:
+		min, max, err := r.band(config, pair)
+		if err != nil {
+			return false, data, err
+		}
+		switch {
+		case quote.Rate <= min:
+			data.Reference, data.Threshold, data.Crossed = min, min, "min"
+			return true, data, nil
+		case quote.Rate >= max:
+			data.Reference, data.Threshold, data.Crossed = max, max, "max"
+			return true, data, nil
+		}
+		return false, data, nil
+
+	case rulePercentChange:
+		history, err := config.History.Range(pair.Name(), quote.Timestamp.Add(-time.Duration(r.Window)), before)
+		if err != nil || len(history) == 0 {
+			return false, data, err
+		}
+		data.Reference = history[0].Rate
+		data.ChangePercent = (quote.Rate - data.Reference) / data.Reference * 100
+		if r.Percent > 0 {
+			return data.ChangePercent >= r.Percent, data, nil
+		}
+		return data.ChangePercent <= r.Percent, data, nil
+
+	case ruleNewHigh, ruleNewLow:
+		history, err := config.History.Range(pair.Name(), quote.Timestamp.AddDate(0, 0, -r.Days), before)
+		if err != nil || len(history) == 0 {
+			return false, data, err
+		}
+		high, low := math.Inf(-1), math.Inf(1)
+		for _, q := range history {
+			high = math.Max(high, q.Rate)
+			low = math.Min(low, q.Rate)
+		}
+		if r.Type == ruleNewHigh {
+			data.Reference = high
+			return quote.Rate > high, data, nil
+		}
+		data.Reference = low
+		return quote.Rate < low, data, nil
+
+	case ruleMACross:
+		history, err := config.History.Range(pair.Name(), quote.Timestamp.Add(-time.Duration(r.Window)), before)
+		if err != nil || len(history) == 0 || prevRate == 0 {
+			return false, data, err
+		}
+		var sum float64
+		for _, q := range history {
+			sum += q.Rate
+		}
+		data.Reference = sum / float64(len(history))
+		crossedUp := prevRate <= data.Reference && quote.Rate > data.Reference
+		crossedDown := prevRate >= data.Reference && quote.Rate < data.Reference
+		return crossedUp || crossedDown, data, nil
+	}
+	return false, data, nil
+}
+
+// checkStale reports whether pair has gone without a successful fetch for
+// longer than the rule's window.
+func (r *AlertRule) checkStale(config *Config, pair *CurrencyPair, now time.Time) (bool, alertData, error) {
+	data := alertData{
+		Rule:   r.Name,
+		Type:   r.Type,
+		Pair:   pair.Name(),
+		From:   pair.From,
+		To:     pair.To,
+		Window: time.Duration(r.Window),
+		Time:   now,
+	}
+	last, ok, err := config.History.Latest(pair.Name())
+	if err != nil || !ok {
+		return false, data, err
+	}
+	data.Rate = last.Rate
+	data.Reference = last.Rate
+	return now.Sub(last.Timestamp) > time.Duration(r.Window), data, nil
+}
+
+// checkProviders compares CIMB with the best competitor in the pair's latest
+// provider comparison, ranked for the rule's amount. It reports whether the
+// competitor gives at least Spread more, or with OnChange whether the best
+// provider changed. A change is only looked for when every provider of the
+// pair is in the comparison, so one failing to fetch does not count as one.
+func (r *AlertRule) checkProviders(config *Config, pair *CurrencyPair, now time.Time) (bool, alertData) {
+	data := alertData{
+		Rule: r.Name,
+		Type: r.Type,
+		Pair: pair.Name(),
+		From: pair.From,
+		To:   pair.To,
+		Time: now,
+	}
+
+	data.Amount = r.Amount
+	if data.Amount == 0 {
+		data.Amount = config.transferAmount()
+	}
+	quotes := slices.Clone(config.comparison(pair.Name()))
+	sortByEffectiveRate(quotes, data.Amount)
+	var own, competitor *Quote
+	for i := range quotes {
+		if quotes[i].Provider == cimbProvider {
+			own = &quotes[i]
+		} else if competitor == nil {
+			competitor = &quotes[i]
+		}
+	}
+	if own == nil || competitor == nil {
+		return false, data
+	}
+
+	data.Rate = own.Rate
+	data.Reference = competitor.effectiveRate(data.Amount)
+	data.Provider = quotes[0].Provider
+	data.PreviousProvider = r.state.Best
+	data.Competitor = competitor.Provider
+	data.CompetitorRate = competitor.Rate
+	data.Difference = competitor.received(data.Amount) - own.received(data.Amount)
+
+	var changed bool
+	if len(quotes)-1 >= config.providerCount(pair.Name()) {
+		changed = r.OnChange && r.state.Best != "" && r.state.Best != data.Provider
+		r.state.Best = data.Provider
+	}
+	return changed || (r.Spread > 0 && data.Difference >= r.Spread), data
+}
+
+// shouldFire turns a check into an alert decision. A rule fires when its
+// condition holds while it is armed, outside its cooldown and under its daily
+// cap; firing disarms it until rearm is reported. The second result reports
+// whether the rule's state changed and should be saved.
+func (r *AlertRule) shouldFire(condition, rearm bool, rate float64, now time.Time) (fire, changed bool) {
+	if rearm && !r.state.Armed {
+		r.state.Armed = true
+		changed = true
+	}
+	if !condition || !r.state.Armed {
+		return false, changed
+	}
+	if r.Cooldown > 0 && !r.state.LastFired.IsZero() && now.Sub(r.state.LastFired) < time.Duration(r.Cooldown) {
+		return false, changed
+	}
+
+	day := now.Format("2006-01-02")
+	if r.state.Day != day {
+		r.state.Day = day
+		r.state.FiredToday = 0
+	}
+	if r.MaxPerDay > 0 && r.state.FiredToday >= r.MaxPerDay {
+		return false, changed
+	}
+
+	r.state.Armed = false
+	r.state.LastFired = now
+	r.state.LastRate = rate
+	r.state.FiredToday++
+	return true, true
+}
+
+// decide applies shouldFire and saves the rule's state when it changed. The
+// daily cap counts days in the configured time zone.
+func (r *AlertRule) decide(config *Config, condition, rearm bool, rate float64, now time.Time) bool {
+	fire, changed := r.shouldFire(condition, rearm, rate, now.In(config.location()))
+	if changed {
+		r.saveState(config)
+	}
+	return fire
+}
+
+func (r *AlertRule) saveState(config *Config) {
+	if config.AlertState == nil {
+		return
+	}
+	if err := config.AlertState.Save(r.Name, r.state); err != nil {
+		logger.Printf("Error: %v", err)
+	}
+}
+
+func (r *AlertRule) render(data alertData) (string, error) {
+	var sb strings.Builder
+	if err := r.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("rule %q: failed to render message: %v", r.Name, err)
+	}
+	return sb.String(), nil
+}
+
+// rulesForPair returns the rules that watch pair.
+func rulesForPair(rules []*AlertRule, pair *CurrencyPair) []*AlertRule {
+	var matched []*AlertRule
+	for _, rule := range rules {
+		if pairKey(rule.Pair) == pairKey(pair.Name()) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// evaluateRules checks the pair's non-stale rules against a freshly fetched
+// quote and sends an alert for each one that fires.
+func evaluateRules(ctx context.Context, config *Config, rules []*AlertRule, pair *CurrencyPair, quote Quote, prevRate float64) {
+	// While paused rules are not evaluated at all, so one whose condition
+	// still holds fires once alerts resume.
+	if config.alertsPausedUntil().After(quote.Timestamp) {
+		return
+	}
+	for _, rule := range rules {
+		if rule.Type == ruleStale || rule.Type == ruleBestProvider {
+			continue
+		}
+		condition, rearm, data, err := rule.check(config, pair, quote, prevRate)
+		if err != nil {
+			logger.Printf("Error evaluating rule %q: %v", rule.Name, err)
+			continue
+		}
+		if rule.decide(config, condition, rearm, quote.Rate, quote.Timestamp) {
+			fireRule(ctx, config, rule, pair, data)
+		}
+	}
+}
+
+// evaluateStaleRules checks the pair's stale rules against the stored
+// history, whether or not the latest fetch succeeded.
+func evaluateStaleRules(ctx context.Context, config *Config, rules []*AlertRule, pair *CurrencyPair, now time.Time) {
+	if config.alertsPausedUntil().After(now) {
+		return
+	}
+	for _, rule := range rules {
+		if rule.Type != ruleStale {
+			continue
+		}
+		condition, data, err := rule.checkStale(config, pair, now)
+		if err != nil {
+			logger.Printf("Error evaluating rule %q: %v", rule.Name, err)
+			continue
+		}
+		if rule.decide(config, condition, !condition, data.Rate, now) {
+			fireRule(ctx, config, rule, pair, data)
+		}
+	}
+}
+
+// evaluateProviderRules checks the pair's best_provider rules against its
+// latest provider comparison.
+func evaluateProviderRules(ctx context.Context, config *Config, rules []*AlertRule, pair *CurrencyPair, now time.Time) {
+	if config.alertsPausedUntil().After(now) {
+		return
+	}
+	for _, rule := range rules {
+		if rule.Type != ruleBestProvider {
+			continue
+		}
+		best := rule.state.Best
+		condition, data := rule.checkProviders(config, pair, now)
+		if rule.state.Best != best {
+			rule.saveState(config)
+		}
+		if rule.decide(config, condition, !condition, data.Rate, now) {
+			fireRule(ctx, config, rule, pair, data)
+		}
+	}
+}
+
+func fireRule(ctx context.Context, config *Config, rule *AlertRule, pair *CurrencyPair, data alertData) {
+	addMessageContext(config, pair, &data)
+	message, err := rule.render(data)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return
+	}
+	logger.Printf("Rule %q fired: %s", rule.Name, message)
+	if config.AlertState != nil {
+		if err := config.AlertState.LogFired(rule.Name, data.Pair, data.Time, message); err != nil {
+			logger.Printf("Error: %v", err)
+		}
+	}
+
+	targets := rule.Targets
+	if len(targets) == 0 {
+		targets = config.NotifyTargets
+	}
+	n := Notification{Message: message, Rule: rule.Name, Pair: data.Pair, Rate: data.Rate, Time: data.Time, Urgent: rule.Urgent}
+	for _, target := range targets {
+		notify(config, target, n)
+	}
+}
+
+// addMessageContext fills in the alertData fields that only matter for the
+// message: the change from the previous rate, what the transfer amount gets,
+// today's high and low, the local time and the page link.
+func addMessageContext(config *Config, pair *CurrencyPair, data *alertData) {
+	if data.PrevRate != 0 {
+		data.Delta = data.Rate - data.PrevRate
+		data.DeltaPercent = data.Delta / data.PrevRate * 100
+	}
+
+	if data.Amount == 0 {
+		data.Amount = config.TransferAmount
+	}
+	if data.Amount > 0 && data.Rate > 0 {
+		quote := Quote{Pair: pair.Name(), Rate: data.Rate, Fees: pair.Fees}
+		data.Received = quote.received(data.Amount)
+		if data.Yesterday = yesterdayClose(config, pair.Name(), data.Time); data.Yesterday != 0 {
+			quote.Rate = data.Yesterday
+			data.ReceivedDelta = data.Received - quote.received(data.Amount)
+		}
+	}
+
+	loc := config.location()
+	data.Time = data.Time.In(loc)
+	data.TimeZone = loc.String()
+	data.Link = pair.URL
+
+	data.DayHigh, data.DayLow = data.Rate, data.Rate
+	y, m, d := data.Time.Date()
+	today, err := config.History.Range(pair.Name(), time.Date(y, m, d, 0, 0, 0, 0, loc), data.Time)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return
+	}
+	for _, q := range today {
+		data.DayHigh = math.Max(data.DayHigh, q.Rate)
+		data.DayLow = math.Min(data.DayLow, q.Rate)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckProvidersRanksForRuleAmount(t *testing.T) {
+	pair, _ := lookupPair("SGD/MYR")
+	config := &Config{Providers: []*Provider{{Name: "UOB", Pair: "SGD/MYR"}}}
+	// UOB has the better rate but a flat fee that only pays off on large
+	// transfers.
+	config.recordComparison("SGD/MYR", []Quote{
+		{Provider: "UOB", Rate: 3.50, Fees: FeeModel{Flat: 20}},
+		{Provider: cimbProvider, Rate: 3.45},
+	})
+
+	rule := &AlertRule{Name: "best", Type: ruleBestProvider, Pair: "SGD/MYR", Spread: 1, Amount: 100}
+	condition, data := rule.checkProviders(config, pair, time.Now())
+	if condition || data.Provider != cimbProvider {
+		t.Errorf("for 100: condition %v, best %q; want false, %q", condition, data.Provider, cimbProvider)
+	}
+
+	rule = &AlertRule{Name: "best", Type: ruleBestProvider, Pair: "SGD/MYR", Spread: 1, Amount: 10000}
+	condition, data = rule.checkProviders(config, pair, time.Now())
+	if !condition || data.Provider != "UOB" {
+		t.Errorf("for 10000: condition %v, best %q; want true, UOB", condition, data.Provider)
+	}
+}
+
+func TestCheckProvidersIgnoresMissingProvider(t *testing.T) {
+	pair, _ := lookupPair("SGD/MYR")
+	config := &Config{Providers: []*Provider{{Name: "DBS", Pair: "SGD/MYR"}, {Name: "Wise", Pair: "SGD/MYR"}}}
+	rule := &AlertRule{Name: "best", Type: ruleBestProvider, Pair: "SGD/MYR", OnChange: true}
+	check := func(quotes ...Quote) bool {
+		config.recordComparison("SGD/MYR", quotes)
+		condition, _ := rule.checkProviders(config, pair, time.Now())
+		return condition
+	}
+
+	cimb := Quote{Provider: cimbProvider, Rate: 3.45}
+	if check(Quote{Provider: "Wise", Rate: 3.48}, Quote{Provider: "DBS", Rate: 3.40}, cimb) {
+		t.Error("fired on the first comparison")
+	}
+	if check(Quote{Provider: "DBS", Rate: 3.40}, cimb) {
+		t.Error("fired while Wise was missing")
+	}
+	if rule.state.Best != "Wise" {
+		t.Errorf("best = %q while Wise was missing, want Wise", rule.state.Best)
+	}
+	if check(Quote{Provider: "Wise", Rate: 3.48}, Quote{Provider: "DBS", Rate: 3.40}, cimb) {
+		t.Error("fired when Wise came back")
+	}
+	if !check(Quote{Provider: "Wise", Rate: 3.41}, Quote{Provider: "DBS", Rate: 3.40}, cimb) {
+		t.Error("did not fire when CIMB became the best")
+	}
+}
+
+func TestAlertStateStoreKeepsBestProvider(t *testing.T) {
+	store := newTestConfig(t).AlertState
+	if err := store.Save("best", ruleState{Armed: true, Best: "Wise"}); err != nil {
+		t.Fatal(err)
+	}
+	st, ok, err := store.Load("best")
+	if err != nil || !ok || st.Best != "Wise" {
+		t.Errorf("Load = %+v, %v, %v; want Best Wise", st, ok, err)
+	}
+}
+
+func TestMaxPerDayUsesConfiguredTimeZone(t *testing.T) {
+	loc := time.FixedZone("+08", 8*3600)
+	config := &Config{Location: loc}
+	rule := &AlertRule{Name: "range", MaxPerDay: 1}
+	rule.state.Armed = true
+
+	// 04:00 and 09:00 on the same day in +08, either side of midnight UTC.
+	if !rule.decide(config, true, true, 3.4, time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)) {
+		t.Fatal("first alert of the day did not fire")
+	}
+	if rule.decide(config, true, true, 3.4, time.Date(2026, 3, 2, 1, 0, 0, 0, time.UTC)) {
+		t.Error("second alert of the same local day fired")
+	}
+	if !rule.decide(config, true, true, 3.4, time.Date(2026, 3, 2, 16, 0, 0, 0, time.UTC)) {
+		t.Error("first alert of the next local day did not fire")
+	}
+}
+
+func TestThresholdRuleBounds(t *testing.T) {
+	for _, tc := range []struct {
+		min, max float64
+		err      string
+	}{
+		{0, 0, ""},
+		{3.40, 3.55, ""},
+		{0, 3.55, "set both min and max"},
+		{3.40, 0, "set both min and max"},
+		{3.55, 3.40, "max must be greater than min"},
+	} {
+		rule := &AlertRule{Type: ruleThreshold, Pair: "SGD/MYR", Min: tc.min, Max: tc.max}
+		err := rule.prepare()
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("min %v, max %v: got %v, want %q", tc.min, tc.max, err, tc.err)
+		}
+	}
+}
+
+func TestThresholdRuleNeedsRange(t *testing.T) {
+	pair := &CurrencyPair{From: "MYR", To: "SGD", Derived: &derivation{description: "inverse of SGD/MYR"}}
+	config := &Config{Pairs: []*CurrencyPair{pair}, NotifyTargets: []string{"60123456789"}, Interval: time.Minute}
+	rule := &AlertRule{Type: ruleThreshold, Pair: "MYR/SGD"}
+	if err := rule.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	config.Rules = []*AlertRule{rule}
+	if err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "no min/max range") {
+		t.Errorf("validateConfig gave %v, want an error for the pair without a range", err)
+	}
+
+	condition, _, _, err := rule.check(config, pair, Quote{Rate: 0.29, Timestamp: time.Now()}, 0)
+	if condition || err == nil {
+		t.Errorf("check gave %v, %v; want an error instead of firing", condition, err)
+	}
+}
+
+func TestProviderCountMatchesPairSpellings(t *testing.T) {
+	config := &Config{Providers: []*Provider{{Name: "DBS", Pair: "sgd/myr"}, {Name: "Wise", Pair: "SGD-MYR"}, {Name: "OCBC", Pair: "SGD/IDR"}}}
+	if n := config.providerCount("SGD/MYR"); n != 2 {
+		t.Errorf("providerCount = %d, want 2", n)
+	}
+}
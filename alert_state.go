@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ruleState is the part of an alert rule's evaluation that must survive a
+// restart, so the same alert is not fired again just because the program
+// came back up.
+type ruleState struct {
+	// Armed is true when the rule may fire. It is cleared when the rule
+	// fires and set again once the rate has moved back.
+	Armed      bool
+	LastFired  time.Time
+	LastRate   float64
+	Day        string // local date FiredToday counts for, YYYY-MM-DD
+	FiredToday int
+	// Best is the best provider at the last comparison, for best_provider
+	// rules with OnChange.
+	Best string
+}
+
+// AlertStateStore persists rule state in the alert_state table.
+type AlertStateStore struct {
+	db *sql.DB
+}
+
+func NewAlertStateStore(db *sql.DB) (*AlertStateStore, error) {
+	err := execSchema(db,
+		`CREATE TABLE IF NOT EXISTS alert_state (
+			rule          TEXT PRIMARY KEY,
+			armed         INTEGER NOT NULL,
+			last_fired_at INTEGER NOT NULL,
+			last_rate     REAL    NOT NULL,
+			day           TEXT    NOT NULL,
+			fired_today   INTEGER NOT NULL,
+			best          TEXT    NOT NULL DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS alert_log (
+			id       INTEGER PRIMARY KEY AUTOINCREMENT,
+			rule     TEXT    NOT NULL,
+			pair     TEXT    NOT NULL,
+			fired_at INTEGER NOT NULL,
+			message  TEXT    NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS alert_log_pair_time ON alert_log (pair, fired_at)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := addColumn(db, "alert_state", "best", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, err
+	}
+	return &AlertStateStore{db: db}, nil
+}
+
+// Load returns the stored state of rule. The boolean is false when the rule
+// has no stored state yet.
+func (s *AlertStateStore) Load(rule string) (ruleState, bool, error) {
+	var (
+		st        ruleState
+		lastFired int64
+	)
+	err := s.db.QueryRow(
+		`SELECT armed, last_fired_at, last_rate, day, fired_today, best FROM alert_state WHERE rule = ?`, rule,
+	).Scan(&st.Armed, &lastFired, &st.LastRate, &st.Day, &st.FiredToday, &st.Best)
+	if err == sql.ErrNoRows {
+		return ruleState{}, false, nil
+	}
+	if err != nil {
+		return ruleState{}, false, fmt.Errorf("failed to load alert state: %v", err)
+	}
+	if lastFired != 0 {
+		st.LastFired = time.UnixMilli(lastFired)
+	}
+	return st, true, nil
+}
+
+func (s *AlertStateStore) Save(rule string, st ruleState) error {
+	var lastFired int64
+	if !st.LastFired.IsZero() {
+		lastFired = st.LastFired.UnixMilli()
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO alert_state (rule, armed, last_fired_at, last_rate, day, fired_today, best) VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (rule) DO UPDATE SET armed = excluded.armed, last_fired_at = excluded.last_fired_at,
+		   last_rate = excluded.last_rate, day = excluded.day, fired_today = excluded.fired_today, best = excluded.best`,
+		rule, st.Armed, lastFired, st.LastRate, st.Day, st.FiredToday, st.Best,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save alert state: %v", err)
+	}
+	return nil
+}
+
+// LogFired records that rule fired, for digests.
+func (s *AlertStateStore) LogFired(rule, pair string, at time.Time, message string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO alert_log (rule, pair, fired_at, message) VALUES (?, ?, ?, ?)`,
+		rule, pair, at.UnixMilli(), message,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log alert: %v", err)
+	}
+	return nil
+}
+
+// CountFired returns how many alerts fired for pair in [from, to).
+func (s *AlertStateStore) CountFired(pair string, from, to time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM alert_log WHERE pair = ? AND fired_at >= ? AND fired_at < ?`,
+		pair, from.UnixMilli(), to.UnixMilli(),
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count alerts: %v", err)
+	}
+	return n, nil
+}
+
+// loadRuleStates restores each rule's state, arming rules seen for the
+// first time.
+func loadRuleStates(store *AlertStateStore, rules []*AlertRule) {
+	for _, rule := range rules {
+		rule.state = ruleState{Armed: true}
+		st, ok, err := store.Load(rule.Name)
+		if err != nil {
+			logger.Printf("Error: %v", err)
+		} else if ok {
+			rule.state = st
+		}
+	}
+}
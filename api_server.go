@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// quoteJSON is the API representation of a Quote.
+type quoteJSON struct {
+	Pair      string    `json:"pair"`
+	Rate      float64   `json:"rate"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Source    string    `json:"source"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+func toQuoteJSON(q Quote) quoteJSON {
+	return quoteJSON{
+		Pair:      q.Pair,
+		Rate:      q.Rate,
+		FetchedAt: q.Timestamp,
+		Source:    q.Source,
+		LatencyMS: q.Latency.Milliseconds(),
+	}
+}
+
+// serveAPI runs the local HTTP API on addr until ctx is cancelled:
+//
+//	GET /rate                     latest quote per pair
+//	GET /history?pair=&from=&to=  stored quotes (from/to as RFC 3339 or YYYY-MM-DD)
+//	GET /thresholds               alert range per pair
+//	PUT /thresholds               change alert ranges, body as returned by GET
+//	GET /health                   WhatsApp connection and last fetch time
+//	GET /metrics                  Prometheus metrics
+func serveAPI(ctx context.Context, addr string, config *Config) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rate", func(w http.ResponseWriter, r *http.Request) {
+		handleRate(w, r, config)
+	})
+	mux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		handleHistory(w, r, config)
+	})
+	mux.HandleFunc("GET /thresholds", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, config.thresholds())
+	})
+	mux.HandleFunc("PUT /thresholds", func(w http.ResponseWriter, r *http.Request) {
+		handleSetThresholds(w, r, config)
+	})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		handleHealth(w, r, config)
+	})
+	mux.HandleFunc("GET /metrics", handleMetrics)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Printf("HTTP API listening on %s", addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func handleRate(w http.ResponseWriter, r *http.Request, config *Config) {
+	pairFilter := r.URL.Query().Get("pair")
+	quotes := []quoteJSON{}
+	for _, q := range config.latestQuotes() {
+		if pairFilter != "" && pairKey(pairFilter) != pairKey(q.Pair) {
+			continue
+		}
+		quotes = append(quotes, toQuoteJSON(q))
+	}
+	writeJSON(w, http.StatusOK, quotes)
+}
+
+func handleHistory(w http.ResponseWriter, r *http.Request, config *Config) {
+	query := r.URL.Query()
+	config.mu.RLock()
+	pair := findPair(config.Pairs, query.Get("pair"))
+	config.mu.RUnlock()
+	if pair == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("pair must name a monitored pair"))
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	var err error
+	if v := query.Get("from"); v != "" {
+		if from, err = parseAPITime(v, false); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid from: %v", err))
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if to, err = parseAPITime(v, true); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid to: %v", err))
+			return
+		}
+	}
+
+	history, err := config.History.Range(pair.Name(), from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	quotes := make([]quoteJSON, 0, len(history))
+	for _, q := range history {
+		quotes = append(quotes, toQuoteJSON(q))
+	}
+	writeJSON(w, http.StatusOK, quotes)
+}
+
+func handleSetThresholds(w http.ResponseWriter, r *http.Request, config *Config) {
+	var updates []Thresholds
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("body must be a JSON list of {pair, min, max}: %v", err))
+		return
+	}
+	if err := config.setThresholds(updates...); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, config.thresholds())
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request, config *Config) {
+	health := struct {
+		WhatsAppConnected bool       `json:"whatsapp_connected"`
+		LastFetch         *time.Time `json:"last_fetch"`
+	}{
+		WhatsAppConnected: config.Connected.Load(),
+	}
+	if last := config.lastFetchTime(); !last.IsZero() {
+		health.LastFetch = &last
+	}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// parseAPITime accepts RFC 3339 timestamps or plain dates in local time. A
+// plain date is the start of that day, or with end set its last millisecond,
+// so that "to=2026-03-01" includes the whole of March 1.
+func parseAPITime(v string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil || !end {
+		return t, err
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Millisecond), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Printf("Error writing HTTP response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
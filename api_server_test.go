@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleSetThresholdsIsAllOrNothing(t *testing.T) {
+	myr, _ := lookupPair("SGD/MYR")
+	idr, _ := lookupPair("SGD/IDR")
+	myr.DesiredMinRate, myr.DesiredMaxRate = 3.40, 3.55
+	config := &Config{Pairs: []*CurrencyPair{myr, idr}}
+
+	body := `[{"pair": "SGD/MYR", "min": 3.30, "max": 3.60}, {"pair": "SGD/IDR", "min": 12000, "max": 11000}]`
+	w := httptest.NewRecorder()
+	handleSetThresholds(w, httptest.NewRequest(http.MethodPut, "/thresholds", strings.NewReader(body)), config)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d for an invalid update, want 400", w.Code)
+	}
+	if myr.DesiredMinRate != 3.40 || myr.DesiredMaxRate != 3.55 {
+		t.Errorf("SGD/MYR changed to %v - %v by a rejected request", myr.DesiredMinRate, myr.DesiredMaxRate)
+	}
+
+	body = `[{"pair": "SGD/MYR", "min": 3.30, "max": 3.60}, {"pair": "SGD/IDR", "min": 11000, "max": 12000}]`
+	w = httptest.NewRecorder()
+	handleSetThresholds(w, httptest.NewRequest(http.MethodPut, "/thresholds", strings.NewReader(body)), config)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if myr.DesiredMinRate != 3.30 || idr.DesiredMaxRate != 12000 {
+		t.Errorf("thresholds not applied: %+v", config.thresholds())
+	}
+}
+
+func TestHandleSetThresholdsListsFixedRules(t *testing.T) {
+	myr, _ := lookupPair("SGD/MYR")
+	myr.DesiredMinRate, myr.DesiredMaxRate = 3.40, 3.55
+	own := &AlertRule{Name: "own range", Type: ruleThreshold, Pair: "sgd-myr", Min: 3.20, Max: 3.70}
+	config := &Config{Pairs: []*CurrencyPair{myr}, Rules: []*AlertRule{own, {Name: "pair range", Type: ruleThreshold, Pair: "SGD/MYR"}}}
+
+	w := httptest.NewRecorder()
+	body := `[{"pair": "SGD/MYR", "min": 3.30, "max": 3.60}]`
+	handleSetThresholds(w, httptest.NewRequest(http.MethodPut, "/thresholds", strings.NewReader(body)), config)
+	var got []Thresholds
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].FixedRules) != 1 || got[0].FixedRules[0] != "own range" {
+		t.Errorf("response %s, want own range listed as a fixed rule", w.Body)
+	}
+	if own.Min != 3.20 || own.Max != 3.70 {
+		t.Errorf("rule with its own range changed to %v - %v", own.Min, own.Max)
+	}
+
+	if reply := botSet(config, []string{"max", "3.65"}); !strings.Contains(reply, "unchanged: own range") {
+		t.Errorf("!set replied %q, want the fixed rule named", reply)
+	}
+}
+
+func TestHandleHistoryIncludesToDate(t *testing.T) {
+	config := newTestConfig(t)
+	pair, _ := lookupPair("SGD/MYR")
+	config.Pairs = []*CurrencyPair{pair}
+
+	for _, at := range []string{"2026-03-01 00:00", "2026-03-01 23:59", "2026-03-02 00:00"} {
+		ts, _ := time.ParseInLocation("2006-01-02 15:04", at, time.Local)
+		if err := config.History.Record(Quote{Pair: "SGD/MYR", Rate: 3.45, Timestamp: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handleHistory(w, httptest.NewRequest(http.MethodGet, "/history?pair=SGD/MYR&from=2026-03-01&to=2026-03-01", nil), config)
+	var quotes []quoteJSON
+	if err := json.NewDecoder(w.Body).Decode(&quotes); err != nil {
+		t.Fatal(err)
+	}
+	if len(quotes) != 2 {
+		t.Errorf("got %d quotes for March 1, want 2", len(quotes))
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// Commands older than this (e.g. delivered in the backlog after a reconnect)
+// are ignored rather than acted on late.
+const maxCommandAge = 5 * time.Minute
+
+const botHelp = `Commands:
+!rate [pair] [amount] - latest rate and what amount gets, e.g. !rate 5000
+!set min|max <rate> [pair] - change an alert threshold
+!pause <duration> - pause alerts, e.g. !pause 2h
+!resume - resume alerts
+!history <period> [pair] - summary, e.g. !history 7d
+!chart [period] [pair] - rate chart, e.g. !chart 7d (default 24h)
+!status - monitor status
+!help - this message
+
+` + subscriptionHelp
+
+// handleBotMessage answers "!" commands sent by authorized senders, replying
+// in the chat the command came from.
+func handleBotMessage(ctx context.Context, config *Config, evt *events.Message) {
+	text := strings.TrimSpace(messageText(evt))
+	if !strings.HasPrefix(text, "!") || time.Since(evt.Info.Timestamp) > maxCommandAge {
+		return
+	}
+	args := strings.Fields(text)
+	authorized := config.isBotAuthorized(evt.Info.MessageSource)
+
+	var reply string
+	switch {
+	case isSubscriptionCommand(args[0]):
+		// Subscriptions belong to the sender, so they are only managed in a
+		// direct chat. Anyone may subscribe when subscriptions are open.
+		if !authorized && !config.SubscriptionsOpen {
+			logger.Printf("Ignoring command from unauthorized sender %s", evt.Info.Sender.User)
+			return
+		}
+		if evt.Info.IsGroup {
+			reply = "Send subscription commands to me in a direct message"
+			break
+		}
+		logger.Printf("Subscription command from %s: %s", evt.Info.Sender.User, text)
+		reply = runSubscriptionCommand(config, evt.Info.Sender.ToNonAD().String(), args)
+	case authorized && strings.ToLower(args[0]) == "!chart":
+		logger.Printf("Bot command from %s: %s", evt.Info.Sender.User, text)
+		msg, failure := botChart(ctx, config, args[1:], time.Now())
+		if msg == nil {
+			reply = failure
+			break
+		}
+		if _, err := config.Client.SendMessage(ctx, evt.Info.Chat, msg); err != nil {
+			logger.Printf("Failed to send bot reply: %v", err)
+		}
+		return
+	case authorized:
+		logger.Printf("Bot command from %s: %s", evt.Info.Sender.User, text)
+		reply = runBotCommand(config, args, time.Now())
+	default:
+		logger.Printf("Ignoring command from unauthorized sender %s", evt.Info.Sender.User)
+		return
+	}
+
+	msg := &waProto.Message{Conversation: proto.String(reply)}
+	if _, err := config.Client.SendMessage(ctx, evt.Info.Chat, msg); err != nil {
+		logger.Printf("Failed to send bot reply: %v", err)
+	}
+}
+
+func messageText(evt *events.Message) string {
+	if text := evt.Message.GetConversation(); text != "" {
+		return text
+	}
+	return evt.Message.GetExtendedTextMessage().GetText()
+}
+
+// runBotCommand executes a command (already split into fields, the first
+// being e.g. "!rate") and returns the reply text.
+func runBotCommand(config *Config, args []string, now time.Time) string {
+	switch strings.ToLower(args[0]) {
+	case "!rate":
+		return botRate(config, args[1:])
+	case "!set":
+		return botSet(config, args[1:])
+	case "!pause":
+		if len(args) < 2 {
+			return "Usage: !pause <duration>, e.g. !pause 2h"
+		}
+		d, err := parseBotDuration(args[1])
+		if err != nil || d <= 0 {
+			return fmt.Sprintf("Invalid duration %q", args[1])
+		}
+		until := config.pauseAlerts(now.Add(d))
+		return fmt.Sprintf("Alerts paused until %s", until.Format("2006-01-02 15:04"))
+	case "!resume":
+		config.pauseAlerts(time.Time{})
+		return "Alerts resumed"
+	case "!history":
+		return botHistory(config, args[1:], now)
+	case "!status":
+		return botStatus(config, now)
+	case "!help":
+		return botHelp
+	default:
+		return "Unknown command.\n" + botHelp
+	}
+}
+
+// botRate replies with the latest rates, optionally of one pair, and what
+// the given or configured transfer amount gets, e.g. "!rate SGD/MYR 5000".
+func botRate(config *Config, args []string) string {
+	var pair string
+	amount := config.TransferAmount
+	for _, arg := range args {
+		if v, err := strconv.ParseFloat(strings.ReplaceAll(arg, ",", ""), 64); err == nil && v > 0 {
+			amount = v
+		} else {
+			pair = arg
+		}
+	}
+
+	quotes := config.latestQuotes()
+	var lines []string
+	for _, q := range quotes {
+		if pair != "" && pairKey(pair) != pairKey(q.Pair) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %.4f (%s)", q.Pair, q.Rate, q.Timestamp.Format("2006-01-02 15:04:05")))
+		if transfer := transferSummary(config, q, amount); transfer != "" {
+			lines = append(lines, transfer)
+		}
+	}
+	if len(lines) == 0 {
+		return "No rate fetched yet"
+	}
+	return strings.Join(lines, "\n")
+}
+
+func botSet(config *Config, args []string) string {
+	if len(args) < 2 {
+		return "Usage: !set min|max <rate> [pair]"
+	}
+	rate, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return fmt.Sprintf("Invalid rate %q", args[1])
+	}
+
+	t, err := config.botPairThresholds(args[2:])
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	switch strings.ToLower(args[0]) {
+	case "min":
+		t.Min = rate
+	case "max":
+		t.Max = rate
+	default:
+		return "Usage: !set min|max <rate> [pair]"
+	}
+	if err := config.setThresholds(t); err != nil {
+		return "Error: " + err.Error()
+	}
+	reply := fmt.Sprintf("%s thresholds: min %.4f, max %.4f", t.Pair, t.Min, t.Max)
+	if len(t.FixedRules) > 0 {
+		reply += "\nRules with their own min/max are unchanged: " + strings.Join(t.FixedRules, ", ")
+	}
+	return reply
+}
+
+func botHistory(config *Config, args []string, now time.Time) string {
+	if len(args) < 1 {
+		return "Usage: !history <period> [pair], e.g. !history 7d"
+	}
+	d, err := parseBotDuration(args[0])
+	if err != nil || d <= 0 {
+		return fmt.Sprintf("Invalid period %q", args[0])
+	}
+	t, err := config.botPairThresholds(args[1:])
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+
+	history, err := config.History.Range(t.Pair, now.Add(-d), now)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return "Failed to read rate history"
+	}
+	if len(history) == 0 {
+		return fmt.Sprintf("No %s history in the last %s", t.Pair, args[0])
+	}
+
+	s := summarize(history)
+	return fmt.Sprintf("%s last %s:\nOpen %.4f\nClose %.4f\nHigh %.4f\nLow %.4f\nAverage %.4f\nChange %+.2f%%",
+		t.Pair, args[0], s.Open, s.Close, s.High, s.Low, s.Average, (s.Close-s.Open)/s.Open*100)
+}
+
+// botChart returns an image message charting a pair over a period, or the
+// text to reply with when there is no chart to send.
+func botChart(ctx context.Context, config *Config, args []string, now time.Time) (*waProto.Message, string) {
+	period := "24h"
+	if len(args) > 0 {
+		period, args = args[0], args[1:]
+	}
+	d, err := parseBotDuration(period)
+	if err != nil || d <= 0 {
+		return nil, fmt.Sprintf("Invalid period %q", period)
+	}
+	t, err := config.botPairThresholds(args)
+	if err != nil {
+		return nil, "Error: " + err.Error()
+	}
+
+	history, err := config.History.Range(t.Pair, now.Add(-d), now)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return nil, "Failed to read rate history"
+	}
+	image, err := renderChart(history, config.location())
+	if err != nil {
+		return nil, fmt.Sprintf("Not enough %s history in the last %s for a chart", t.Pair, period)
+	}
+
+	s := summarize(history)
+	caption := fmt.Sprintf("%s last %s: %.4f to %.4f (%+.2f%%), high %.4f, low %.4f",
+		t.Pair, period, s.Open, s.Close, (s.Close-s.Open)/s.Open*100, s.High, s.Low)
+	msg, err := imageMessage(ctx, config.Client, image, caption)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return nil, "Failed to upload chart"
+	}
+	return msg, ""
+}
+
+func botStatus(config *Config, now time.Time) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "WhatsApp connected: %v\n", config.Connected.Load())
+	if last := config.lastFetchTime(); last.IsZero() {
+		sb.WriteString("Last fetch: never\n")
+	} else {
+		fmt.Fprintf(&sb, "Last fetch: %s\n", last.Format("2006-01-02 15:04:05"))
+	}
+	if until := config.alertsPausedUntil(); until.After(now) {
+		fmt.Fprintf(&sb, "Alerts paused until %s\n", until.Format("2006-01-02 15:04"))
+	} else {
+		sb.WriteString("Alerts active\n")
+	}
+	for _, t := range config.thresholds() {
+		fmt.Fprintf(&sb, "%s: min %.4f, max %.4f\n", t.Pair, t.Min, t.Max)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// botPairThresholds returns the thresholds of the pair named in args, or of
+// the first monitored pair when args is empty.
+func (c *Config) botPairThresholds(args []string) (Thresholds, error) {
+	all := c.thresholds()
+	if len(all) == 0 {
+		return Thresholds{}, fmt.Errorf("not monitoring any pair")
+	}
+	if len(args) == 0 {
+		return all[0], nil
+	}
+	for _, t := range all {
+		if pairKey(t.Pair) == pairKey(args[0]) {
+			return t, nil
+		}
+	}
+	return Thresholds{}, fmt.Errorf("pair %s is not being monitored", args[0])
+}
+
+// parseBotDuration parses durations like "90m", "2h" and also "7d" for days.
+func parseBotDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// isBotAuthorized reports whether a message may run commands: it must come
+// from this account, or from a number or group on the allow list.
+func (c *Config) isBotAuthorized(source types.MessageSource) bool {
+	if source.IsFromMe {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, allowed := range c.BotAllowed {
+		if allowed == source.Sender.User || (source.IsGroup && allowed == source.Chat.User) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveBotAllowed replaces group names on the allow list with group IDs.
+func resolveBotAllowed(config *Config) {
+	config.mu.RLock()
+	resolved := append([]string(nil), config.BotAllowed...)
+	config.mu.RUnlock()
+
+	for i, allowed := range resolved {
+		if !isGroupIdentifier(allowed) {
+			continue
+		}
+		groupID, err := matchGroupID(config.Client, allowed)
+		if err != nil {
+			logger.Printf("Bot allow list: %v", err)
+			continue
+		}
+		resolved[i] = groupID
+	}
+
+	config.mu.Lock()
+	config.BotAllowed = resolved
+	config.mu.Unlock()
+}
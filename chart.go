@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+const (
+	chartWidth  = 800
+	chartHeight = 400
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	chartAxis       = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	chartLine       = color.RGBA{0xc4, 0x1e, 0x3a, 0xff} // CIMB red
+	chartText       = color.RGBA{0x30, 0x30, 0x30, 0xff}
+)
+
+// renderChart draws history (oldest first) as a PNG line chart with the
+// rate on the y axis and time on the x axis. It is drawn with the standard
+// library only, with a small built-in font for the axis labels. Times are
+// labelled in loc.
+func renderChart(history []Quote, loc *time.Location) ([]byte, error) {
+	if len(history) < 2 {
+		return nil, fmt.Errorf("not enough history for a chart")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	// Plot area
+	left, right, top, bottom := 100, chartWidth-20, 20, chartHeight-40
+
+	s := summarize(history)
+	low, high := s.Low, s.High
+	pad := (high - low) * 0.05
+	if pad == 0 {
+		pad = high * 0.001
+	}
+	low, high = low-pad, high+pad
+
+	start, end := history[0].Timestamp, history[len(history)-1].Timestamp
+	span := end.Sub(start)
+	if span <= 0 {
+		span = time.Second
+	}
+	xOf := func(t time.Time) int {
+		return left + int(float64(right-left)*float64(t.Sub(start))/float64(span))
+	}
+	yOf := func(rate float64) int {
+		return bottom - int(float64(bottom-top)*(rate-low)/(high-low))
+	}
+
+	// Horizontal grid lines with rate labels
+	format := rateLabelFormat(high)
+	const gridLines = 5
+	for i := 0; i <= gridLines; i++ {
+		rate := low + (high-low)*float64(i)/gridLines
+		y := yOf(rate)
+		drawLine(img, left, y, right, y, chartGrid, 1)
+		label := fmt.Sprintf(format, rate)
+		drawText(img, left-10-textWidth(label), y-5, label, chartText)
+	}
+
+	// Axes
+	drawLine(img, left, top, left, bottom, chartAxis, 1)
+	drawLine(img, left, bottom, right, bottom, chartAxis, 1)
+
+	// Start and end times under the x axis
+	startLabel, endLabel := chartTimeLabels(start, end, loc)
+	drawText(img, left, bottom+12, startLabel, chartText)
+	drawText(img, right-textWidth(endLabel), bottom+12, endLabel, chartText)
+
+	// The rate line, with a dot on the latest rate
+	for i := 1; i < len(history); i++ {
+		drawLine(img,
+			xOf(history[i-1].Timestamp), yOf(history[i-1].Rate),
+			xOf(history[i].Timestamp), yOf(history[i].Rate),
+			chartLine, 2)
+	}
+	lastX, lastY := xOf(end), yOf(history[len(history)-1].Rate)
+	fillRect(img, lastX-3, lastY-3, lastX+4, lastY+4, chartLine)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("error encoding chart: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ChartRequest asks for a chart of Pair's rates between From and To. It is
+// stored with queued notifications and drawn when the message is sent.
+type ChartRequest struct {
+	Pair string    `json:"pair"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// chartImage draws the chart req asks for from the rate history.
+func chartImage(config *Config, req ChartRequest) ([]byte, error) {
+	history, err := config.History.Range(req.Pair, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	return renderChart(history, config.location())
+}
+
+// chartTimeLabels formats the first and last times of a chart in loc, with
+// just the dates when the chart spans more than three days.
+func chartTimeLabels(start, end time.Time, loc *time.Location) (string, string) {
+	format := "01-02 15:04"
+	if end.Sub(start) > 3*24*time.Hour {
+		format = "2006-01-02"
+	}
+	return start.In(loc).Format(format), end.In(loc).Format(format)
+}
+
+// rateLabelFormat shows fewer decimals for larger rates, e.g. SGD/IDR.
+func rateLabelFormat(max float64) string {
+	switch {
+	case max >= 1000:
+		return "%.0f"
+	case max >= 100:
+		return "%.2f"
+	default:
+		return "%.4f"
+	}
+}
+
+// drawLine draws a line of the given thickness with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA, thickness int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		fillRect(img, x0, y0, x0+thickness, y0+thickness, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			x0 += sx
+		} else {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// chartFont is a 3x5 pixel font for the characters axis labels need. Each
+// row is three bits, the most significant on the left.
+var chartFont = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'.': {0, 0, 0, 0, 2},
+	'-': {0, 0, 7, 0, 0},
+	':': {0, 2, 0, 2, 0},
+	' ': {0, 0, 0, 0, 0},
+}
+
+const chartFontScale = 2
+
+func textWidth(s string) int {
+	return len(s) * 4 * chartFontScale
+}
+
+// drawText draws s with its top left corner at x, y. Characters missing
+// from chartFont are left blank.
+func drawText(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range s {
+		glyph := chartFont[r]
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) != 0 {
+					px, py := x+col*chartFontScale, y+row*chartFontScale
+					fillRect(img, px, py, px+chartFontScale, py+chartFontScale, c)
+				}
+			}
+		}
+		x += 4 * chartFontScale
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChartTimeLabelsUseLocation(t *testing.T) {
+	loc := time.FixedZone("+08", 8*3600)
+	start := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+
+	from, to := chartTimeLabels(start, start.Add(6*time.Hour), loc)
+	if from != "03-02 04:00" || to != "03-02 10:00" {
+		t.Errorf("labels %q, %q; want 03-02 04:00, 03-02 10:00", from, to)
+	}
+	from, to = chartTimeLabels(start, start.Add(7*24*time.Hour), loc)
+	if from != "2026-03-02" || to != "2026-03-09" {
+		t.Errorf("labels %q, %q; want 2026-03-02, 2026-03-09", from, to)
+	}
+}
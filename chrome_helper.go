@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/chromedp/chromedp"
+	"golang.org/x/net/html"
 )
 
 var (
@@ -18,7 +19,9 @@ var (
 	chromeProcesses []*os.Process
 )
 
-func createChromeContext() (context.Context, context.CancelFunc) {
+// createChromeContext starts a headless Chrome that lives until parent is
+// cancelled. Waiting for it to come up stops early when wait is cancelled.
+func createChromeContext(parent, wait context.Context) (context.Context, context.CancelFunc) {
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.Flag("headless", true),
 		chromedp.Flag("disable-gpu", true),
@@ -28,7 +31,7 @@ func createChromeContext() (context.Context, context.CancelFunc) {
 		chromedp.Flag("disable-popup-blocking", true),
 		chromedp.Flag("disable-infobars", true),
 	)
-	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	allocCtx, allocCancel := chromedp.NewExecAllocator(parent, opts...)
 	ctx, cancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(logger.Printf))
 
 	if err := chromedp.Run(ctx); err != nil {
@@ -39,7 +42,10 @@ func createChromeContext() (context.Context, context.CancelFunc) {
 		}
 	}
 
-	time.Sleep(time.Second)
+	select {
+	case <-time.After(time.Second):
+	case <-wait.Done():
+	}
 
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
@@ -123,59 +129,176 @@ func getForceKillCommand() *exec.Cmd {
 	return exec.Command("pkill", "-9", "chrome")
 }
 
-func fetchAndPrintLabelWithRetry(ctx context.Context, prevRate *float64, config *Config) error {
-	const (
-		maxRetries = 3
-		retryDelay = 5 * time.Second
+// chromeBrowser is a headless Chrome instance shared by every
+// ChromeRateSource, so monitoring several pairs still runs a single browser.
+// It is started lazily on first use and stopped when parent is cancelled or
+// its owner closes it; the sources using it never do.
+type chromeBrowser struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// context returns the browser's context, starting it first if need be.
+// Starting stops waiting for Chrome when ctx is cancelled.
+func (b *chromeBrowser) context(ctx context.Context) context.Context {
+	if b.ctx == nil {
+		b.ctx, b.cancel = createChromeContext(b.parent, ctx)
+	}
+	return b.ctx
+}
+
+// reset tears down the browser so the next fetch starts a fresh one.
+func (b *chromeBrowser) reset() {
+	if b.cancel != nil {
+		logger.Println("Recreating Chrome context.")
+		chromeRecreations.Inc()
+		b.cancel()
+	}
+	b.ctx, b.cancel = nil, nil
+}
+
+func (b *chromeBrowser) close() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.ctx, b.cancel = nil, nil
+}
+
+// ChromeRateSource scrapes the rate label from a page rendered in headless
+// Chrome. With Row set the rate is read from a table instead, as with
+// HTTPRateSource.
+type ChromeRateSource struct {
+	URL      string
+	Selector string
+	Row      string
+	Column   int
+	Parser   *RateParser
+
+	browser *chromeBrowser
+}
+
+func NewChromeRateSource(browser *chromeBrowser, url, selector string, parser *RateParser) *ChromeRateSource {
+	return &ChromeRateSource{URL: url, Selector: selector, Parser: parser, browser: browser}
+}
+
+func (s *ChromeRateSource) Name() string {
+	return "chrome"
+}
+
+func (s *ChromeRateSource) Fetch(ctx context.Context) (Quote, error) {
+	// Run against the browser context but stop as soon as the caller gives up.
+	runCtx, cancel := context.WithCancel(s.browser.context(ctx))
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	if s.Row != "" {
+		return s.fetchTable(runCtx)
+	}
+
+	var labelContent string
+	err := chromedp.Run(runCtx,
+		chromedp.Navigate(s.URL),
+		chromedp.WaitVisible(s.Selector, chromedp.ByID),
+		chromedp.Text(s.Selector, &labelContent, chromedp.ByID),
 	)
+	if err != nil {
+		return Quote{}, fmt.Errorf("error fetching label: %w", err)
+	}
+
+	rate, err := s.Parser.Parse(labelContent)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Quote{Rate: rate, Timestamp: time.Now(), Source: s.Name()}, nil
+}
+
+// fetchTable renders the page and reads the rate from its table.
+func (s *ChromeRateSource) fetchTable(ctx context.Context) (Quote, error) {
+	var page string
+	err := chromedp.Run(ctx,
+		chromedp.Navigate(s.URL),
+		chromedp.WaitVisible("table", chromedp.ByQuery),
+		chromedp.OuterHTML("html", &page, chromedp.ByQuery),
+	)
+	if err != nil {
+		return Quote{}, fmt.Errorf("error fetching page: %w", err)
+	}
+
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return Quote{}, fmt.Errorf("error parsing HTML: %w", err)
+	}
+	rate, err := extractRate(doc, s.Selector, s.Row, s.Column, s.Parser)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Quote{Rate: rate, Timestamp: time.Now(), Source: s.Name()}, nil
+}
+
+func (s *ChromeRateSource) Reset() {
+	s.browser.reset()
+}
+
+// retryDelay is how long to wait before fetching a pair's rate again after
+// a failed attempt.
+var retryDelay = 5 * time.Second
+
+func fetchAndPrintLabelWithRetry(ctx context.Context, m *monitoredPair, config *Config) error {
+	const maxRetries = 3
 
 	var err error
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		if err = fetchAndPrintLabel(ctx, prevRate, config); err == nil {
+		attemptLabel := strconv.Itoa(attempt + 1)
+		fetchAttempts.Inc(m.pair.Name(), attemptLabel)
+		if err = fetchAndPrintLabel(ctx, m, config); err == nil {
 			return nil
 		}
-		logger.Printf("Attempt %d failed: %v. Retrying in %v...", attempt+1, err, retryDelay)
+		fetchFailures.Inc(m.pair.Name(), attemptLabel)
+		logger.Printf("%s: attempt %d failed: %v. Retrying in %v...", m.pair.Name(), attempt+1, err, retryDelay)
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-time.After(retryDelay):
 		}
 	}
-	return fmt.Errorf("failed to fetch label after %d attempts: %w", maxRetries, err)
+	return fmt.Errorf("failed to fetch %s after %d attempts: %w", m.pair.Name(), maxRetries, err)
 }
 
-func fetchAndPrintLabel(ctx context.Context, prevRate *float64, config *Config) error {
-	var labelContent string
-	err := chromedp.Run(ctx,
-		chromedp.Navigate("https://www.cimbclicks.com.sg/sgd-to-myr"),
-		chromedp.WaitVisible(`#rateStr`, chromedp.ByID),
-		chromedp.Text(`#rateStr`, &labelContent, chromedp.ByID),
-	)
+// fetchAndPrintLabel runs one monitoring cycle for a pair: fetch a quote from
+// its source, record and print it, then evaluate the pair's alert rules.
+func fetchAndPrintLabel(ctx context.Context, m *monitoredPair, config *Config) error {
+	start := time.Now()
+	quote, err := m.source.Fetch(ctx)
 	if err != nil {
-		return fmt.Errorf("error fetching label: %w", err)
+		return fmt.Errorf("%s: %w", m.source.Name(), err)
+	}
+	if err := checkRateChange(quote.Rate, m.prevRate); err != nil {
+		return fmt.Errorf("%s: %w", m.source.Name(), err)
 	}
+	quote.Pair = m.pair.Name()
+	quote.Provider = cimbProvider
+	quote.Fees = m.pair.Fees
+	quote.Latency = time.Since(start)
 
-	currentRate, err := parseRate(labelContent)
-	if err != nil {
-		return err
+	if config.History != nil {
+		if err := config.History.Record(quote); err != nil {
+			logger.Printf("Error: %v", err)
+		}
 	}
 
-	printColoredRate(currentRate, *prevRate)
+	config.recordLatest(quote)
+	rateGauge.Set(quote.Rate, quote.Pair)
+	lastFetchGauge.Set(float64(quote.Timestamp.Unix()), quote.Pair)
 
-	if shouldNotify(currentRate, config) {
-		sendWhatsAppNotification(config, currentRate)
-		config.LastNotifiedRate = currentRate
-	}
+	printColoredRate(m.pair, quote.Rate, m.prevRate, transferSummary(config, quote, config.TransferAmount))
+
+	evaluateRules(ctx, config, m.rules, m.pair, quote, m.prevRate)
+	notifySubscribers(ctx, config, m.pair, quote)
 
-	*prevRate = currentRate
+	m.prevRate = quote.Rate
 	return nil
 }
-
-func parseRate(labelContent string) (float64, error) {
-	rateStr := strings.TrimPrefix(labelContent, "SGD 1.00 = MYR ")
-	currentRate, err := strconv.ParseFloat(rateStr, 64)
-	if err != nil {
-		return 0, fmt.Errorf("error parsing rate: %w", err)
-	}
-	return currentRate, nil
-}
\ No newline at end of file
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// received is how much of the To currency amount (in From) buys from the
+// quote's provider after its fees.
+func (q Quote) received(amount float64) float64 {
+	return max(amount-q.Fees.fee(amount), 0) * q.Rate
+}
+
+// effectiveRate is the rate after fees for a transfer of amount.
+func (q Quote) effectiveRate(amount float64) float64 {
+	if amount <= 0 {
+		return q.Rate
+	}
+	return q.received(amount) / amount
+}
+
+// compareProviders fetches every provider of a monitored pair and prints
+// them next to the pair's own latest rate, best effective rate first. A
+// provider that fails, or quotes a rate implausibly far from the pair's own,
+// is left out until its next fetch.
+func compareProviders(ctx context.Context, config *Config, sources []*providerSource) {
+	if len(sources) == 0 {
+		return
+	}
+
+	own := make(map[string]Quote)
+	for _, q := range config.latestQuotes() {
+		own[q.Pair] = q
+	}
+
+	compared := make(map[string][]Quote)
+	for _, s := range sources {
+		if ctx.Err() != nil {
+			return
+		}
+		start := time.Now()
+		q, err := s.Fetch(ctx)
+		if err != nil {
+			logger.Printf("Error: %v", err)
+			continue
+		}
+		if err := checkRateChange(q.Rate, own[q.Pair].Rate); err != nil {
+			logger.Printf("Error: %s: %v", q.Provider, err)
+			continue
+		}
+		q.Latency = time.Since(start)
+		providerRateGauge.Set(q.Rate, q.Pair, q.Provider)
+		compared[q.Pair] = append(compared[q.Pair], q)
+	}
+
+	for _, t := range config.thresholds() {
+		pair, quotes := t.Pair, compared[t.Pair]
+		if len(quotes) == 0 {
+			continue
+		}
+		if q, ok := own[pair]; ok {
+			quotes = append(quotes, q)
+		}
+		sortByEffectiveRate(quotes, config.transferAmount())
+		config.recordComparison(pair, quotes)
+		printComparison(pair, quotes, config.transferAmount())
+	}
+}
+
+// sortByEffectiveRate puts the quote giving the most for amount first.
+func sortByEffectiveRate(quotes []Quote, amount float64) {
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].effectiveRate(amount) > quotes[j].effectiveRate(amount)
+	})
+}
+
+// printComparison prints quotes (best first) side by side, with the best
+// highlighted.
+func printComparison(pair string, quotes []Quote, amount float64) {
+	from, to, _ := strings.Cut(pair, "/")
+	headerColor := color.New(color.FgHiCyan).SprintfFunc()
+	bestColor := color.New(color.FgGreen, color.Bold).SprintfFunc()
+	rowColor := color.New(color.FgWhite).SprintfFunc()
+
+	fmt.Println(headerColor("%s for %s %.2f:", pair, from, amount))
+	fmt.Println(headerColor("  %-16s %10s %10s %10s %14s", "Provider", "Rate", "Fee", "Effective", to+" received"))
+	for i, q := range quotes {
+		line := fmt.Sprintf("%-16s %10.4f %10.2f %10.4f %14.2f", q.Provider, q.Rate,
+			q.Fees.fee(amount), q.effectiveRate(amount), q.received(amount))
+		if i == 0 {
+			fmt.Println(bestColor("* %s", line))
+		} else {
+			fmt.Println(rowColor("  %s", line))
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+const defaultInterval = time.Minute
+
+// Duration is a time.Duration that reads as a string such as "90s" or "1m"
+// in the config file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1m\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// FileConfig is the JSON config file used to run without prompts, e.g.
+//
+//	{
+//	  "target": "60123456789",
+//	  "interval": "1m",
+//	  "pairs": [
+//	    {"pair": "SGD/MYR", "min": 3.40, "max": 3.55},
+//	    {"pair": "SGD/IDR", "min": 11500, "max": 12200}
+//	  ]
+//	}
+type FileConfig struct {
+	Source         string               `json:"source,omitempty"`
+	Interval       Duration             `json:"interval,omitempty"`
+	Polling        *PollSchedule        `json:"polling,omitempty"`
+	Target         string               `json:"target,omitempty"`
+	Targets        []string             `json:"targets,omitempty"`
+	DB             string               `json:"db,omitempty"`
+	Listen         string               `json:"listen,omitempty"`
+	Timezone       string               `json:"timezone,omitempty"`
+	RetentionDays  *int                 `json:"retention_days,omitempty"`
+	Pairs          []PairFileConfig     `json:"pairs,omitempty"`
+	Derived        []DerivedFileConfig  `json:"derived,omitempty"`
+	Providers      []ProviderFileConfig `json:"providers,omitempty"`
+	TransferAmount float64              `json:"transfer_amount,omitempty"`
+	Rules          []*AlertRule         `json:"rules,omitempty"`
+	Digests        []*Digest            `json:"digests,omitempty"`
+	QuietHours     []*QuietHours        `json:"quiet_hours,omitempty"`
+	Notifiers      *NotifiersFileConfig `json:"notifiers,omitempty"`
+	BotAllowed     []string             `json:"bot_allowed,omitempty"`
+	// OpenSubscriptions lets anyone subscribe by direct message.
+	OpenSubscriptions bool `json:"open_subscriptions,omitempty"`
+}
+
+// PairFileConfig configures one pair. Pair must name a known pair unless URL
+// and Selector, or JSONURL and JSONField, are given; any of them overrides
+// the known value. Patterns and Decimal say how to read a label the prefix
+// does not match.
+type PairFileConfig struct {
+	Pair     string  `json:"pair"`
+	URL      string  `json:"url,omitempty"`
+	Selector string  `json:"selector,omitempty"`
+	Prefix   string  `json:"prefix,omitempty"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+
+	// JSONURL and JSONField name a JSON endpoint serving the rate, with
+	// dots in JSONField for nested objects, e.g. "data.rate".
+	JSONURL   string `json:"json_url,omitempty"`
+	JSONField string `json:"json_field,omitempty"`
+	FeeFileConfig
+	RateFormatFileConfig
+}
+
+func loadFileConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var fc FileConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	for _, rule := range fc.Rules {
+		if rule.MessageFile == "" {
+			continue
+		}
+		if rule.Message != "" {
+			return nil, fmt.Errorf("rule %q: message and message_file cannot both be set", rule.Name)
+		}
+		file := rule.MessageFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		message, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: failed to read message template: %v", rule.Name, err)
+		}
+		rule.Message = strings.TrimRight(string(message), "\n")
+	}
+	return &fc, nil
+}
+
+// apply copies every value set in the file into config.
+func (fc *FileConfig) apply(config *Config) error {
+	if fc.Source != "" {
+		config.SourceMode = fc.Source
+	}
+	if fc.Interval > 0 {
+		config.Interval = time.Duration(fc.Interval)
+	}
+	if fc.Polling != nil {
+		if err := fc.Polling.prepare(); err != nil {
+			return err
+		}
+		config.Polling = fc.Polling
+	}
+	if fc.Target != "" || len(fc.Targets) > 0 {
+		config.NotifyTargets = nil
+		if fc.Target != "" {
+			config.NotifyTargets = append(config.NotifyTargets, fc.Target)
+		}
+		config.NotifyTargets = append(config.NotifyTargets, fc.Targets...)
+	}
+	if fc.DB != "" {
+		config.DBPath = fc.DB
+	}
+	if fc.Listen != "" {
+		config.Listen = fc.Listen
+	}
+	if fc.Timezone != "" {
+		loc, err := time.LoadLocation(fc.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %v", err)
+		}
+		config.Location = loc
+	}
+	if len(fc.BotAllowed) > 0 {
+		config.BotAllowed = fc.BotAllowed
+	}
+	if fc.RetentionDays != nil {
+		config.RetentionDays = *fc.RetentionDays
+	}
+	if fc.OpenSubscriptions {
+		config.SubscriptionsOpen = true
+	}
+
+	if fc.Notifiers != nil {
+		if err := fc.Notifiers.apply(config.Notifiers); err != nil {
+			return err
+		}
+	}
+
+	if len(fc.Pairs) > 0 {
+		config.Pairs = nil
+	}
+	for _, pc := range fc.Pairs {
+		pair, err := pc.toPair()
+		if err != nil {
+			return err
+		}
+		config.Pairs = append(config.Pairs, pair)
+	}
+
+	config.DerivedPairs = fc.Derived
+
+	if len(fc.Providers) > 0 {
+		config.Providers = nil
+	}
+	for _, pc := range fc.Providers {
+		provider, err := pc.toProvider()
+		if err != nil {
+			return err
+		}
+		config.Providers = append(config.Providers, provider)
+	}
+	if fc.TransferAmount > 0 {
+		config.TransferAmount = fc.TransferAmount
+	}
+
+	names := make(map[string]bool)
+	for _, rule := range fc.Rules {
+		if err := rule.prepare(); err != nil {
+			return err
+		}
+		// Alert state is stored by rule name
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q: duplicate rule name", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	config.Rules = fc.Rules
+
+	for _, digest := range fc.Digests {
+		if err := digest.prepare(); err != nil {
+			return err
+		}
+	}
+	config.Digests = fc.Digests
+
+	for _, q := range fc.QuietHours {
+		if err := q.prepare(); err != nil {
+			return err
+		}
+	}
+	config.QuietHours = fc.QuietHours
+	return nil
+}
+
+func (pc PairFileConfig) toPair() (*CurrencyPair, error) {
+	pair, err := lookupPair(pc.Pair)
+	if err != nil {
+		// Not a known pair: everything needed to read it must be configured.
+		from, to, ok := strings.Cut(pc.Pair, "/")
+		if !ok || (pc.URL == "" || pc.Selector == "") && pc.JSONURL == "" {
+			return nil, fmt.Errorf("%v (unknown pairs need \"FROM/TO\" and a url and selector or a json_url)", err)
+		}
+		pair = &CurrencyPair{From: strings.ToUpper(from), To: strings.ToUpper(to)}
+	}
+	if pc.URL != "" {
+		pair.URL = pc.URL
+	}
+	if pc.Selector != "" {
+		pair.Selector = pc.Selector
+	}
+	if pc.Prefix != "" {
+		pair.Prefix = pc.Prefix
+	}
+	if (pc.JSONURL == "") != (pc.JSONField == "") {
+		return nil, fmt.Errorf("%s: json_url and json_field must be given together", pair.Name())
+	}
+	pair.JSONURL, pair.JSONField = pc.JSONURL, pc.JSONField
+	pair.DesiredMinRate = pc.Min
+	pair.DesiredMaxRate = pc.Max
+	if pair.Fees, err = pc.toFeeModel(); err != nil {
+		return nil, fmt.Errorf("%s: %v", pair.Name(), err)
+	}
+	if pair.Format, err = pc.toRateFormat(); err != nil {
+		return nil, fmt.Errorf("%s: %v", pair.Name(), err)
+	}
+	return pair, nil
+}
+
+// parseCommandLine fills config from the config file (if any) and then from
+// flags, so a flag always wins over the file. It reports whether the program
+// should run the interactive menu: only when stdin is a terminal and nothing
+// on the command line already says what to monitor.
+func parseCommandLine(config *Config, args []string) (interactive bool, err error) {
+	fs := flag.NewFlagSet("cimbGo2", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; monitoring starts without prompts")
+	source := fs.String("source", "auto", "rate source: http, chrome, or auto (http with chrome fallback)")
+	dbPath := fs.String("db", defaultDBPath, "path to the SQLite database")
+	retentionDays := fs.Int("retention-days", 90, "days of rate history to keep (0 keeps everything)")
+	pairs := fs.String("pairs", "", "comma-separated currency pairs to monitor, e.g. SGD/MYR,SGD/IDR")
+	minRate := fs.Float64("min", 0, "desired minimum rate for the first pair")
+	maxRate := fs.Float64("max", 0, "desired maximum rate for the first pair")
+	target := fs.String("target", "", "comma-separated WhatsApp phone numbers, group names or group IDs to notify")
+	providers := fs.String("providers", "", "comma-separated providers to compare with CIMB, e.g. DBS,OCBC,UOB,Wise")
+	amount := fs.Float64("amount", 0, "transfer amount, in the pair's From currency, to show what it gets after fees (default 1000 for comparisons only)")
+	interval := fs.Duration("interval", defaultInterval, "how often to fetch the rates")
+	daemon := fs.Bool("daemon", false, "run as a service: no menu or prompts, write a PID file, exit on SIGINT/SIGTERM")
+	botAllow := fs.String("bot-allow", "", "comma-separated phone numbers, group names or group IDs allowed to send bot commands")
+	openSubscriptions := fs.Bool("open-subscriptions", false, "let anyone manage their own alert subscriptions by direct message")
+	listen := fs.String("listen", "", "address for the local HTTP API, e.g. 127.0.0.1:8080 (disabled when empty)")
+	timezone := fs.String("timezone", "", "IANA timezone for times in alert messages, e.g. Asia/Singapore (default local time)")
+	deadLetters := fs.Bool("dead-letters", false, "print the notifications that could not be delivered and exit")
+	pidFile := fs.String("pidfile", "", "write the process ID to this file (default "+defaultPIDFile+" with -daemon)")
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+
+	// Defaults
+	config.SourceMode = *source
+	config.DBPath = *dbPath
+	config.RetentionDays = *retentionDays
+	config.Interval = *interval
+	config.Polling = &PollSchedule{}
+	if err := config.Polling.prepare(); err != nil {
+		return false, err
+	}
+	config.Notifiers = map[string]Notifier{notifierWhatsApp: &WhatsAppNotifier{config: config}}
+
+	if *configPath != "" {
+		fc, err := loadFileConfig(*configPath)
+		if err != nil {
+			return false, err
+		}
+		if err := fc.apply(config); err != nil {
+			return false, err
+		}
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if set["source"] {
+		config.SourceMode = *source
+	}
+	if set["db"] {
+		config.DBPath = *dbPath
+	}
+	if set["retention-days"] {
+		config.RetentionDays = *retentionDays
+	}
+	if set["interval"] {
+		config.Interval = *interval
+	}
+	if set["target"] {
+		config.NotifyTargets = splitTargets(*target)
+	}
+	if set["listen"] {
+		config.Listen = *listen
+	}
+	if set["timezone"] {
+		config.Location, err = time.LoadLocation(*timezone)
+		if err != nil {
+			return false, fmt.Errorf("invalid timezone: %v", err)
+		}
+	}
+	if set["bot-allow"] {
+		config.BotAllowed = nil
+		for _, allowed := range strings.Split(*botAllow, ",") {
+			if allowed = strings.TrimSpace(allowed); allowed != "" {
+				config.BotAllowed = append(config.BotAllowed, allowed)
+			}
+		}
+	}
+	if set["open-subscriptions"] {
+		config.SubscriptionsOpen = *openSubscriptions
+	}
+	config.PIDFile = *pidFile
+	config.ShowDeadLetters = *deadLetters
+	if *daemon && config.PIDFile == "" {
+		config.PIDFile = defaultPIDFile
+	}
+	if set["pairs"] {
+		config.Pairs, err = parsePairList(*pairs)
+		if err != nil {
+			return false, err
+		}
+	}
+	if (set["min"] || set["max"]) && len(config.Pairs) == 0 {
+		pair, _ := lookupPair("SGD/MYR")
+		config.Pairs = []*CurrencyPair{pair}
+	}
+	if set["providers"] {
+		config.Providers, err = parseProviderList(*providers)
+		if err != nil {
+			return false, err
+		}
+	}
+	if set["amount"] {
+		config.TransferAmount = *amount
+	}
+	if set["min"] {
+		config.Pairs[0].DesiredMinRate = *minRate
+	}
+	if set["max"] {
+		config.Pairs[0].DesiredMaxRate = *maxRate
+	}
+
+	// Derived pairs come last, once the pairs they are computed from are known
+	for _, dc := range config.DerivedPairs {
+		pair, err := dc.toPair(config.Pairs)
+		if err != nil {
+			return false, err
+		}
+		config.Pairs = append(config.Pairs, pair)
+	}
+
+	configured := *configPath != "" || set["target"] || set["min"] || set["max"] || set["pairs"]
+	interactive = !*daemon && !configured && !*deadLetters && isatty.IsTerminal(os.Stdin.Fd())
+	return interactive, nil
+}
+
+// validateConfig checks that a non-interactive run has everything it needs.
+func validateConfig(config *Config) error {
+	if len(config.Pairs) == 0 {
+		return fmt.Errorf("no currency pairs configured")
+	}
+	for _, pair := range config.Pairs {
+		if pair.Derived != nil && pair.DesiredMinRate == 0 && pair.DesiredMaxRate == 0 {
+			continue
+		}
+		if pair.DesiredMaxRate <= pair.DesiredMinRate {
+			return fmt.Errorf("%s: maximum rate (%.4f) must be greater than minimum rate (%.4f)",
+				pair.Name(), pair.DesiredMaxRate, pair.DesiredMinRate)
+		}
+	}
+	for _, provider := range config.Providers {
+		if findPair(config.Pairs, provider.Pair) == nil {
+			return fmt.Errorf("provider %q: pair %s is not being monitored", provider.Name, provider.Pair)
+		}
+	}
+	if config.TransferAmount < 0 {
+		return fmt.Errorf("transfer amount cannot be negative")
+	}
+	for _, rule := range config.Rules {
+		pair := findPair(config.Pairs, rule.Pair)
+		if pair == nil {
+			return fmt.Errorf("rule %q: pair %s is not being monitored", rule.Name, rule.Pair)
+		}
+		if rule.Type == ruleThreshold && rule.Min == 0 && rule.Max == 0 && pair.DesiredMinRate == 0 && pair.DesiredMaxRate == 0 {
+			return fmt.Errorf("rule %q: %s has no min/max range; set the rule's min and max", rule.Name, pair.Name())
+		}
+		if rule.Type == ruleBestProvider && !slices.ContainsFunc(config.Providers, func(p *Provider) bool {
+			return pairKey(p.Pair) == pairKey(rule.Pair)
+		}) {
+			return fmt.Errorf("rule %q: no providers are compared for %s", rule.Name, rule.Pair)
+		}
+	}
+	if len(config.Rules) == 0 {
+		if _, err := defaultRules(config.Pairs); err != nil {
+			return err
+		}
+	}
+	if len(config.NotifyTargets) == 0 {
+		return fmt.Errorf("no WhatsApp target configured")
+	}
+	if config.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+)
+
+// errConsoleClosed is returned once stdin has been closed or failed.
+var errConsoleClosed = errors.New("standard input closed")
+
+// console serialises every read from stdin through a single goroutine, so a
+// prompt that is waiting for input can be abandoned when the program shuts
+// down, and the menu and the restart checker never race for the same line.
+type console struct {
+	lines chan string
+}
+
+func newConsole(r io.Reader) *console {
+	c := &console{lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			c.lines <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			logger.Printf("Error reading standard input: %v", err)
+		}
+		close(c.lines)
+	}()
+	return c
+}
+
+// readLine waits for the next line of input or for ctx to be cancelled.
+func (c *console) readLine(ctx context.Context) (string, error) {
+	select {
+	case line, ok := <-c.lines:
+		if !ok {
+			return "", errConsoleClosed
+		}
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// stdin is the console used by the interactive menu and prompts. It is only
+// set up when running interactively.
+var stdin *console
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Exit codes returned by the program.
+const (
+	exitOK          = 0 // normal exit, including shutdown on SIGINT/SIGTERM
+	exitFailure     = 1 // a runtime failure such as the database or WhatsApp
+	exitConfigError = 2 // invalid flags or config file
+)
+
+const defaultPIDFile = "cimbGo2.pid"
+
+// writePIDFile records the current process ID in path. It refuses to
+// overwrite the file while the process it names is still running.
+func writePIDFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && processRunning(pid) {
+			return fmt.Errorf("already running with PID %d (PID file %s)", pid, path)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write PID file: %v", err)
+	}
+	return nil
+}
+
+// removePIDFile deletes the PID file if it still names this process.
+func removePIDFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		logger.Printf("Failed to remove PID file: %v", err)
+	}
+}
+
+func processRunning(pid int) bool {
+	if pid == os.Getpid() {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+const defaultDBPath = "whatsapp.db"
+
+// openDatabase opens the SQLite database shared by the whatsmeow store and
+// the program's own tables.
+func openDatabase(path string) (*sql.DB, error) {
+	dbString := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", path)
+	db, err := sql.Open("sqlite", dbString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return db, nil
+}
+
+// execSchema runs each statement in order, stopping at the first failure.
+// Statements should be idempotent (CREATE ... IF NOT EXISTS).
+func execSchema(db *sql.DB, statements ...string) error {
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to apply schema: %v", err)
+		}
+	}
+	return nil
+}
+
+// addColumn adds column, with its type and default in def, to a table
+// created before the column existed.
+func addColumn(db *sql.DB, table, column, def string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return fmt.Errorf("failed to read schema of %s: %v", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to read schema of %s: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema of %s: %v", table, err)
+	}
+	rows.Close()
+	return execSchema(db, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def))
+}
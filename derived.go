@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// errDerivedUnchanged is returned by a derived source when none of its legs
+// has a new rate since its last quote.
+var errDerivedUnchanged = errors.New("no new rates to derive from")
+
+// DerivedFileConfig configures a pair that is computed from the latest
+// rates of other pairs instead of fetched: either the Inverse of a pair,
+// e.g. "SGD/MYR" for MYR/SGD, or a cross rate through Legs, e.g.
+// ["SGD/USD", "USD/MYR"]. A leg may name a pair the other way round
+// ("USD/MYR" when MYR/USD is monitored) and is then inverted. Name defaults
+// to "TO/FROM" for an inverse and the path, e.g. "SGD/USD/MYR", for a
+// cross rate. Min and Max give it an alert range like a fetched pair.
+type DerivedFileConfig struct {
+	Name    string   `json:"name,omitempty"`
+	Inverse string   `json:"inverse,omitempty"`
+	Legs    []string `json:"legs,omitempty"`
+	Min     float64  `json:"min,omitempty"`
+	Max     float64  `json:"max,omitempty"`
+}
+
+func (dc DerivedFileConfig) String() string {
+	switch {
+	case dc.Name != "":
+		return dc.Name
+	case dc.Inverse != "":
+		return "inverse of " + dc.Inverse
+	default:
+		return strings.Join(dc.Legs, " x ")
+	}
+}
+
+// derivation is how a derived pair's rate is computed: the product of its
+// legs' latest rates, each inverted when invert is set.
+type derivation struct {
+	legs        []derivedLeg
+	description string // e.g. "inverse of SGD/MYR" or "via USD"
+}
+
+type derivedLeg struct {
+	pair   string
+	invert bool
+}
+
+// toPair resolves the legs against pairs, which must come earlier in the
+// configuration, and returns the derived pair.
+func (dc DerivedFileConfig) toPair(pairs []*CurrencyPair) (*CurrencyPair, error) {
+	if (dc.Inverse == "") == (len(dc.Legs) == 0) {
+		return nil, fmt.Errorf("derived pair %s: set either inverse or legs", dc)
+	}
+	if len(dc.Legs) == 1 {
+		return nil, fmt.Errorf("derived pair %s: a cross rate needs at least two legs", dc)
+	}
+
+	pair := &CurrencyPair{Label: dc.Name, DesiredMinRate: dc.Min, DesiredMaxRate: dc.Max}
+	d := &derivation{}
+	if dc.Inverse != "" {
+		source := findPair(pairs, dc.Inverse)
+		if source == nil {
+			return nil, fmt.Errorf("derived pair %s: pair %s is not being monitored", dc, dc.Inverse)
+		}
+		pair.From, pair.To = source.To, source.From
+		d.legs = []derivedLeg{{pair: source.Name(), invert: true}}
+		d.description = "inverse of " + source.Name()
+	} else {
+		path := []string{}
+		for i, name := range dc.Legs {
+			leg, from, to, err := resolveLeg(pairs, name)
+			if err != nil {
+				return nil, fmt.Errorf("derived pair %s: %v", dc, err)
+			}
+			if i == 0 {
+				pair.From = from
+				path = append(path, from)
+			} else if from != pair.To {
+				return nil, fmt.Errorf("derived pair %s: leg %s does not start from %s", dc, name, pair.To)
+			}
+			pair.To = to
+			path = append(path, to)
+			d.legs = append(d.legs, leg)
+		}
+		if pair.Label == "" {
+			pair.Label = strings.Join(path, "/")
+		}
+		d.description = "via " + strings.Join(path[1:len(path)-1], ", ")
+	}
+	pair.Derived = d
+
+	if findPair(pairs, pair.Name()) != nil {
+		return nil, fmt.Errorf("derived pair %s: a pair of that name is already monitored; give it another name", pair.Name())
+	}
+	if (pair.DesiredMinRate != 0 || pair.DesiredMaxRate != 0) && pair.DesiredMaxRate <= pair.DesiredMinRate {
+		return nil, fmt.Errorf("derived pair %s: max must be greater than min", pair.Name())
+	}
+	return pair, nil
+}
+
+// resolveLeg finds the pair a leg names, directly or the other way round.
+func resolveLeg(pairs []*CurrencyPair, name string) (leg derivedLeg, from, to string, err error) {
+	if p := findPair(pairs, name); p != nil {
+		return derivedLeg{pair: p.Name()}, p.From, p.To, nil
+	}
+	legFrom, legTo, ok := strings.Cut(name, "/")
+	if ok {
+		if p := findPair(pairs, legTo+"/"+legFrom); p != nil {
+			return derivedLeg{pair: p.Name(), invert: true}, p.To, p.From, nil
+		}
+	}
+	return derivedLeg{}, "", "", fmt.Errorf("neither %s nor its inverse is being monitored", name)
+}
+
+// derivedSource computes a derived pair's rate from the latest quotes of its
+// legs. The quote carries the time of the newest leg.
+type derivedSource struct {
+	config *Config
+	pair   *CurrencyPair
+	last   time.Time
+}
+
+func (s *derivedSource) Name() string {
+	return "derived"
+}
+
+func (s *derivedSource) Fetch(ctx context.Context) (Quote, error) {
+	latest := make(map[string]Quote)
+	for _, q := range s.config.latestQuotes() {
+		latest[q.Pair] = q
+	}
+
+	rate := 1.0
+	var newest time.Time
+	for _, leg := range s.pair.Derived.legs {
+		q, ok := latest[leg.pair]
+		if !ok || q.Rate == 0 {
+			return Quote{}, fmt.Errorf("no %s rate yet", leg.pair)
+		}
+		if leg.invert {
+			rate /= q.Rate
+		} else {
+			rate *= q.Rate
+		}
+		if q.Timestamp.After(newest) {
+			newest = q.Timestamp
+		}
+	}
+	if !newest.After(s.last) {
+		return Quote{}, errDerivedUnchanged
+	}
+	s.last = newest
+	return Quote{Rate: rate, Timestamp: newest, Source: s.Name()}, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Digest periods.
+const (
+	digestDay  = "day"
+	digestWeek = "week"
+)
+
+// Digest is a summary of every monitored pair (open, close, high, low,
+// average, change from the previous period and alerts fired) sent on a cron
+// schedule in the configured timezone, e.g. "0 18 * * *" for 6pm daily.
+type Digest struct {
+	Name     string   `json:"name,omitempty"`
+	Schedule string   `json:"schedule"`
+	Period   string   `json:"period,omitempty"` // day (default) or week
+	Targets  []string `json:"targets,omitempty"`
+	// Chart adds a chart of each pair over the period, for WhatsApp targets.
+	Chart bool `json:"chart,omitempty"`
+
+	schedule *cronSchedule
+}
+
+func (d *Digest) prepare() error {
+	if d.Period == "" {
+		d.Period = digestDay
+	}
+	if d.Period != digestDay && d.Period != digestWeek {
+		return fmt.Errorf("digest %q: period must be %q or %q", d.Name, digestDay, digestWeek)
+	}
+	if d.Name == "" {
+		d.Name = map[string]string{digestDay: "Daily digest", digestWeek: "Weekly digest"}[d.Period]
+	}
+
+	schedule, err := parseCronSchedule(d.Schedule)
+	if err != nil {
+		return fmt.Errorf("digest %q: %v", d.Name, err)
+	}
+	d.schedule = schedule
+	return nil
+}
+
+// length is how far back the digest looks.
+func (d *Digest) length() time.Duration {
+	if d.Period == digestWeek {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+func (d *Digest) label() string {
+	if d.Period == digestWeek {
+		return "last 7 days"
+	}
+	return "last 24 hours"
+}
+
+// render builds the digest message for the period ending at now.
+func (d *Digest) render(config *Config, now time.Time) (string, error) {
+	from := now.Add(-d.length())
+	label := d.label()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s, %s\n", d.Name, now.Format("Mon 2 Jan 15:04 MST"))
+	for _, t := range config.thresholds() {
+		history, err := config.History.Range(t.Pair, from, now)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "\n%s (%s)\n", t.Pair, label)
+		if len(history) == 0 {
+			sb.WriteString("No rates fetched\n")
+			continue
+		}
+
+		s := summarize(history)
+		fmt.Fprintf(&sb, "Open %.4f  Close %.4f\n", s.Open, s.Close)
+		fmt.Fprintf(&sb, "High %.4f  Low %.4f\n", s.High, s.Low)
+		fmt.Fprintf(&sb, "Average %.4f\n", s.Average)
+
+		previous, err := config.History.Range(t.Pair, from.Add(-d.length()), from)
+		if err != nil {
+			return "", err
+		}
+		if len(previous) > 0 {
+			prevClose := previous[len(previous)-1].Rate
+			fmt.Fprintf(&sb, "Change vs previous %s: %+.2f%%\n", d.Period, (s.Close-prevClose)/prevClose*100)
+		}
+
+		if config.AlertState != nil {
+			fired, err := config.AlertState.CountFired(t.Pair, from, now)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&sb, "Alerts fired: %d\n", fired)
+		}
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// sendDigest queues the digest for its targets, or the default targets.
+func sendDigest(config *Config, d *Digest, now time.Time) {
+	message, err := d.render(config, now)
+	if err != nil {
+		logger.Printf("Error: %s: %v", d.Name, err)
+		return
+	}
+	logger.Printf("Sending %s", strings.ToLower(d.Name))
+
+	targets := d.Targets
+	if len(targets) == 0 {
+		targets = config.NotifyTargets
+	}
+	n := Notification{Message: message, Rule: d.Name, Time: now}
+	for _, target := range targets {
+		notify(config, target, n)
+		if kind, _ := splitTarget(target); !d.Chart || kind != notifierWhatsApp {
+			continue
+		}
+		for _, t := range config.thresholds() {
+			notify(config, target, Notification{
+				Message: fmt.Sprintf("%s, %s", t.Pair, d.label()),
+				Rule:    d.Name,
+				Pair:    t.Pair,
+				Time:    now,
+				Chart:   &ChartRequest{Pair: t.Pair, From: now.Add(-d.length()), To: now},
+			})
+		}
+	}
+}
+
+// runDigests sends each configured digest on its schedule until ctx is
+// cancelled.
+func runDigests(ctx context.Context, config *Config) {
+	if len(config.Digests) == 0 {
+		return
+	}
+	for {
+		now := time.Now().In(config.location())
+		var next time.Time
+		for _, d := range config.Digests {
+			if t := d.schedule.Next(now); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, d := range config.Digests {
+			if d.schedule.Next(now).Equal(next) {
+				sendDigest(config, d, next)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailNotifier sends alerts by email through an SMTP server. The target is
+// the recipient address, e.g. "email:me@example.com". STARTTLS is used when
+// the server offers it; set TLS for servers that expect TLS from the start
+// (usually port 465).
+type EmailNotifier struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
+	TLS      bool   `json:"tls,omitempty"`
+}
+
+func (e *EmailNotifier) Name() string {
+	return notifierEmail
+}
+
+func (e *EmailNotifier) prepare() error {
+	if e.Host == "" || e.From == "" {
+		return fmt.Errorf("host and from are required")
+	}
+	if e.Port == 0 {
+		e.Port = 587
+		if e.TLS {
+			e.Port = 465
+		}
+	}
+	return nil
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.Target == "" {
+		return fmt.Errorf("no recipient address")
+	}
+
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	// net/smtp knows nothing of contexts; a deadline bounds the whole exchange.
+	deadline := time.Now().Add(time.Minute)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if e.TLS {
+		conn = tls.Client(conn, &tls.Config{ServerName: e.Host})
+	}
+	client, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error starting SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !e.TLS {
+		if err := client.StartTLS(&tls.Config{ServerName: e.Host}); err != nil {
+			return fmt.Errorf("error starting TLS: %w", err)
+		}
+	}
+	if e.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+
+	if err := client.Mail(e.From); err != nil {
+		return fmt.Errorf("error sending MAIL FROM: %w", err)
+	}
+	if err := client.Rcpt(n.Target); err != nil {
+		return fmt.Errorf("error sending RCPT TO: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error sending DATA: %w", err)
+	}
+	if _, err := w.Write(e.message(n)); err != nil {
+		return fmt.Errorf("error writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+	return client.Quit()
+}
+
+func (e *EmailNotifier) message(n Notification) []byte {
+	subject := "CIMB rate alert"
+	if n.Pair != "" {
+		subject = fmt.Sprintf("CIMB rate alert: %s %.4f", n.Pair, n.Rate)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From: %s\r\n", e.From)
+	fmt.Fprintf(&sb, "To: %s\r\n", n.Target)
+	fmt.Fprintf(&sb, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&sb, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(strings.ReplaceAll(n.Message, "\n", "\r\n"))
+	sb.WriteString("\r\n")
+	return []byte(sb.String())
+}
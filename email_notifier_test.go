@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn accepts one SMTP session on a local port and sends the
+// commands it received and the raw DATA on the returned channels.
+func smtpStandIn(t *testing.T) (port int, commands chan []string, data chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	commands, data = make(chan []string, 1), make(chan string, 1)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		var received []string
+		defer func() { commands <- received }()
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimRight(line, "\r\n")
+			received = append(received, cmd)
+			switch verb := strings.ToUpper(strings.Fields(cmd)[0]); verb {
+			case "EHLO":
+				reply("250-localhost")
+				reply("250 8BITMIME")
+			case "DATA":
+				reply("354 go ahead")
+				var sb strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					sb.WriteString(line)
+				}
+				data <- sb.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, commands, data
+}
+
+func TestEmailNotifier(t *testing.T) {
+	port, commands, data := smtpStandIn(t)
+	email := &EmailNotifier{Host: "127.0.0.1", Port: port, From: "alerts@example.com"}
+	if err := email.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	n := Notification{Target: "me@example.com", Message: "Alert", Pair: "SGD/MYR", Rate: 3.45, Time: time.Now()}
+	if err := email.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-commands
+	want := []string{"EHLO", "MAIL FROM:<alerts@example.com>", "RCPT TO:<me@example.com>", "DATA", "QUIT"}
+	if len(got) != len(want) {
+		t.Fatalf("commands %q, want %q", got, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("command %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+	if body := <-data; !strings.Contains(body, "Subject: CIMB rate alert: SGD/MYR 3.4500\r\n") {
+		t.Errorf("DATA %q has no subject with the pair and rate", body)
+	}
+}
+
+func TestEmailNotifierMessage(t *testing.T) {
+	email := &EmailNotifier{From: "alerts@example.com"}
+	at := time.Date(2026, 3, 1, 9, 30, 0, 0, time.FixedZone("+08", 8*3600))
+	msg := string(email.message(Notification{
+		Target: "me@example.com", Message: "Rate up\nNow 3.4500", Pair: "SGD/MYR", Rate: 3.45, Time: at,
+	}))
+
+	header, body, ok := strings.Cut(msg, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message %q has no blank line after the header", msg)
+	}
+	for _, h := range []string{
+		"From: alerts@example.com",
+		"To: me@example.com",
+		"Subject: CIMB rate alert: SGD/MYR 3.4500",
+		"Date: Sun, 01 Mar 2026 09:30:00 +0800",
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	} {
+		if !strings.Contains(header+"\r\n", h+"\r\n") {
+			t.Errorf("header %q has no %q", header, h)
+		}
+	}
+	if body != "Rate up\r\nNow 3.4500\r\n" {
+		t.Errorf("body %q, want CRLF line endings", body)
+	}
+	if strings.Contains(strings.ReplaceAll(msg, "\r\n", ""), "\n") {
+		t.Errorf("message %q has a bare LF", msg)
+	}
+
+	if subject := string(email.message(Notification{Target: "me@example.com", Message: "Digest"})); !strings.Contains(subject, "Subject: CIMB rate alert\r\n") {
+		t.Errorf("message without a pair %q, want the plain subject", subject)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTransferAmount = 1000
+
+// FeeModel is what a provider charges on a transfer, in the From currency:
+// a flat fee plus a percentage of the amount. With Tiers the first tier the
+// amount fits in sets both instead.
+type FeeModel struct {
+	Flat    float64
+	Percent float64
+	Tiers   []FeeTier
+}
+
+// FeeTier is the fee for transfers of up to UpTo (no limit when zero).
+type FeeTier struct {
+	UpTo    float64 `json:"up_to,omitempty"`
+	Fee     float64 `json:"fee,omitempty"`
+	Percent float64 `json:"percent,omitempty"`
+}
+
+// fee returns the total fee on a transfer of amount.
+func (f FeeModel) fee(amount float64) float64 {
+	flat, percent := f.Flat, f.Percent
+	for _, tier := range f.Tiers {
+		if tier.UpTo == 0 || amount <= tier.UpTo {
+			flat, percent = tier.Fee, tier.Percent
+			break
+		}
+	}
+	return flat + amount*percent/100
+}
+
+// FeeFileConfig is how a fee model is written in the config file, as part
+// of a pair or a provider: "fee" and "fee_percent", or "fee_tiers" in
+// increasing order of "up_to" with the last one open-ended.
+type FeeFileConfig struct {
+	Fee        float64   `json:"fee,omitempty"`
+	FeePercent float64   `json:"fee_percent,omitempty"`
+	FeeTiers   []FeeTier `json:"fee_tiers,omitempty"`
+}
+
+func (fc FeeFileConfig) toFeeModel() (FeeModel, error) {
+	model := FeeModel{Flat: fc.Fee, Percent: fc.FeePercent, Tiers: fc.FeeTiers}
+	if fc.Fee < 0 || fc.FeePercent < 0 || fc.FeePercent >= 100 {
+		return FeeModel{}, fmt.Errorf("fee must be positive and fee_percent below 100")
+	}
+	for i, tier := range fc.FeeTiers {
+		if tier.Fee < 0 || tier.Percent < 0 || tier.Percent >= 100 {
+			return FeeModel{}, fmt.Errorf("fee tier %d: fee must be positive and percent below 100", i+1)
+		}
+		if i > 0 && (fc.FeeTiers[i-1].UpTo == 0 || tier.UpTo != 0 && tier.UpTo <= fc.FeeTiers[i-1].UpTo) {
+			return FeeModel{}, fmt.Errorf("fee tier %d: up_to must increase, with only the last tier open-ended", i+1)
+		}
+	}
+	return model, nil
+}
+
+// transferAmount returns the configured transfer amount, or the default
+// when none is configured.
+func (c *Config) transferAmount() float64 {
+	if c.TransferAmount > 0 {
+		return c.TransferAmount
+	}
+	return defaultTransferAmount
+}
+
+// yesterdayClose returns the last rate of pair fetched before today began
+// in the configured timezone, or zero when there is none.
+func yesterdayClose(config *Config, pair string, now time.Time) float64 {
+	if config.History == nil {
+		return 0
+	}
+	y, m, d := now.In(config.location()).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, config.location())
+	history, err := config.History.Range(pair, today.AddDate(0, 0, -1), today.Add(-time.Millisecond))
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return 0
+	}
+	if len(history) == 0 {
+		return 0
+	}
+	return history[len(history)-1].Rate
+}
+
+// transferSummary describes what a transfer of amount gets at quote's rate
+// and fees, and the change from yesterday's closing rate, e.g.
+// "SGD 5,000.00 = MYR 16,372.50 (+12.30 vs yesterday)". It is empty when
+// amount is zero.
+func transferSummary(config *Config, quote Quote, amount float64) string {
+	if amount <= 0 {
+		return ""
+	}
+	from, to, _ := strings.Cut(quote.Pair, "/")
+	if pair := findPair(config.Pairs, quote.Pair); pair != nil {
+		from, to = pair.From, pair.To
+	}
+	received := quote.received(amount)
+
+	summary := fmt.Sprintf("%s %s = %s %s", from, formatMoney(amount), to, formatMoney(received))
+	if yesterday := yesterdayClose(config, quote.Pair, quote.Timestamp); yesterday != 0 {
+		q := quote
+		q.Rate = yesterday
+		summary += fmt.Sprintf(" (%s vs yesterday)", formatSignedMoney(received-q.received(amount)))
+	}
+	return summary
+}
+
+// formatMoney formats v with two decimals and thousands separators, e.g.
+// 16372.5 as "16,372.50".
+func formatMoney(v float64) string {
+	v = math.Round(v*100) / 100
+	s := strconv.FormatFloat(math.Abs(v), 'f', 2, 64)
+	whole, frac, _ := strings.Cut(s, ".")
+	var sb strings.Builder
+	if v < 0 {
+		sb.WriteByte('-')
+	}
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String() + "." + frac
+}
+
+func formatSignedMoney(v float64) string {
+	if math.Round(v*100) >= 0 {
+		return "+" + formatMoney(v)
+	}
+	return formatMoney(v)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RateHistory stores every successfully fetched quote in the rate_history
+// table so the baseline survives restarts and trends can be analysed later.
+type RateHistory struct {
+	db *sql.DB
+	// Retention is how long quotes are kept. Zero keeps them forever.
+	Retention time.Duration
+}
+
+func NewRateHistory(db *sql.DB, retention time.Duration) (*RateHistory, error) {
+	err := execSchema(db,
+		`CREATE TABLE IF NOT EXISTS rate_history (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			pair       TEXT    NOT NULL,
+			rate       REAL    NOT NULL,
+			fetched_at INTEGER NOT NULL,
+			source     TEXT    NOT NULL,
+			latency_ms INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS rate_history_pair_time ON rate_history (pair, fetched_at)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &RateHistory{db: db, Retention: retention}, nil
+}
+
+// Record stores a fetched quote.
+func (h *RateHistory) Record(q Quote) error {
+	_, err := h.db.Exec(
+		`INSERT INTO rate_history (pair, rate, fetched_at, source, latency_ms) VALUES (?, ?, ?, ?, ?)`,
+		q.Pair, q.Rate, q.Timestamp.UnixMilli(), q.Source, q.Latency.Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record rate: %v", err)
+	}
+	return nil
+}
+
+// Latest returns the most recent quote stored for pair. The boolean is false
+// when nothing has been stored yet.
+func (h *RateHistory) Latest(pair string) (Quote, bool, error) {
+	row := h.db.QueryRow(
+		`SELECT pair, rate, fetched_at, source, latency_ms FROM rate_history
+		 WHERE pair = ? ORDER BY fetched_at DESC LIMIT 1`, pair)
+	q, err := scanQuote(row)
+	if err == sql.ErrNoRows {
+		return Quote{}, false, nil
+	}
+	if err != nil {
+		return Quote{}, false, fmt.Errorf("failed to load latest rate: %v", err)
+	}
+	return q, true, nil
+}
+
+// Range returns the quotes for pair fetched in [from, to], oldest first.
+func (h *RateHistory) Range(pair string, from, to time.Time) ([]Quote, error) {
+	rows, err := h.db.Query(
+		`SELECT pair, rate, fetched_at, source, latency_ms FROM rate_history
+		 WHERE pair = ? AND fetched_at BETWEEN ? AND ? ORDER BY fetched_at`,
+		pair, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rate history: %v", err)
+	}
+	defer rows.Close()
+
+	var quotes []Quote
+	for rows.Next() {
+		q, err := scanQuote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rate history: %v", err)
+		}
+		quotes = append(quotes, q)
+	}
+	return quotes, rows.Err()
+}
+
+// Prune deletes quotes older than the retention period and returns how many
+// were removed.
+func (h *RateHistory) Prune(now time.Time) (int64, error) {
+	if h.Retention <= 0 {
+		return 0, nil
+	}
+	res, err := h.db.Exec(`DELETE FROM rate_history WHERE fetched_at < ?`, now.Add(-h.Retention).UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune rate history: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+type scannable interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanQuote(row scannable) (Quote, error) {
+	var (
+		q                  Quote
+		fetchedAt, latency int64
+	)
+	if err := row.Scan(&q.Pair, &q.Rate, &fetchedAt, &q.Source, &latency); err != nil {
+		return Quote{}, err
+	}
+	q.Timestamp = time.UnixMilli(fetchedAt)
+	q.Latency = time.Duration(latency) * time.Millisecond
+	return q, nil
+}
+
+// rateSummary describes a run of quotes, oldest first.
+type rateSummary struct {
+	Open, Close, High, Low, Average float64
+	Count                           int
+}
+
+func summarize(history []Quote) rateSummary {
+	if len(history) == 0 {
+		return rateSummary{}
+	}
+	s := rateSummary{
+		Open:  history[0].Rate,
+		Close: history[len(history)-1].Rate,
+		High:  math.Inf(-1),
+		Low:   math.Inf(1),
+		Count: len(history),
+	}
+	var sum float64
+	for _, q := range history {
+		s.High = math.Max(s.High, q.Rate)
+		s.Low = math.Min(s.Low, q.Rate)
+		sum += q.Rate
+	}
+	s.Average = sum / float64(len(history))
+	return s
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// HTTPRateSource fetches the rate page (or the JSON endpoint behind it) with
+// a plain HTTP request, avoiding the cost of starting headless Chrome.
+//
+// For HTML responses the text of the element matching Selector (an element
+// ID such as "#rateStr") is parsed, or with Row set, cell Column (from 0) of
+// the first table row containing Row. For JSON responses JSONField names the
+// value to read, using dots for nested objects (e.g. "data.rate"), and
+// FeeField optionally names the transfer fee.
+type HTTPRateSource struct {
+	URL       string
+	Selector  string
+	Row       string
+	Column    int
+	JSONField string
+	FeeField  string
+	Parser    *RateParser
+	Client    *http.Client
+}
+
+func NewHTTPRateSource(url, selector string, parser *RateParser) *HTTPRateSource {
+	return &HTTPRateSource{
+		URL:      url,
+		Selector: selector,
+		Parser:   parser,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *HTTPRateSource) Name() string {
+	return "http"
+}
+
+func (s *HTTPRateSource) Fetch(ctx context.Context) (Quote, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return Quote{}, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; cimbGo2)")
+	req.Header.Set("Accept", "text/html,application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return Quote{}, fmt.Errorf("error fetching page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Quote{}, fmt.Errorf("unexpected status fetching page: %s", resp.Status)
+	}
+
+	quote := Quote{Timestamp: time.Now(), Source: s.Name()}
+	if s.JSONField != "" || strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		quote.Rate, quote.Fees.Flat, err = s.extractJSON(resp.Body)
+	} else {
+		quote.Rate, err = s.extractHTML(resp.Body)
+	}
+	if err != nil {
+		return Quote{}, err
+	}
+	return quote, nil
+}
+
+func (s *HTTPRateSource) extractHTML(body io.Reader) (float64, error) {
+	doc, err := html.Parse(body)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing HTML: %w", err)
+	}
+	return extractRate(doc, s.Selector, s.Row, s.Column, s.Parser)
+}
+
+// extractRate reads the rate from the element with the ID in selector or,
+// when row is set, from the table cell at column of the row containing row.
+func extractRate(doc *html.Node, selector, row string, column int, parser *RateParser) (float64, error) {
+	var labelContent, where string
+	if row != "" {
+		cells := findTableRow(doc, row)
+		if cells == nil {
+			return 0, fmt.Errorf("no table row containing %q in page", row)
+		}
+		if column < 0 || column >= len(cells) {
+			return 0, fmt.Errorf("row %q has %d cells, wanted cell %d", row, len(cells), column)
+		}
+		labelContent = strings.TrimSpace(nodeText(cells[column]))
+		where = fmt.Sprintf("cell %d of row %q", column, row)
+	} else {
+		id := strings.TrimPrefix(selector, "#")
+		node := findElementByID(doc, id)
+		if node == nil {
+			return 0, fmt.Errorf("element %s not found in page", selector)
+		}
+		labelContent = strings.TrimSpace(nodeText(node))
+		where = "element " + selector
+	}
+
+	if labelContent == "" {
+		// The page fills the label in with JavaScript; nothing to parse.
+		return 0, fmt.Errorf("%s is empty", where)
+	}
+	return parser.Parse(labelContent)
+}
+
+func (s *HTTPRateSource) extractJSON(body io.Reader) (rate, fee float64, err error) {
+	var data interface{}
+	if err := json.NewDecoder(body).Decode(&data); err != nil {
+		return 0, 0, fmt.Errorf("error decoding JSON: %w", err)
+	}
+
+	if rate, err = s.jsonNumber(data, s.JSONField); err != nil {
+		return 0, 0, err
+	}
+	if s.FeeField != "" {
+		if fee, err = s.jsonNumber(data, s.FeeField); err != nil {
+			return 0, 0, err
+		}
+	}
+	return rate, fee, nil
+}
+
+// jsonNumber reads the number at field, with dots for nested objects; an
+// empty field is the whole document.
+func (s *HTTPRateSource) jsonNumber(data interface{}, field string) (float64, error) {
+	if field != "" {
+		for _, key := range strings.Split(field, ".") {
+			obj, ok := data.(map[string]interface{})
+			if !ok {
+				return 0, fmt.Errorf("field %s not found in JSON response", field)
+			}
+			data, ok = obj[key]
+			if !ok {
+				return 0, fmt.Errorf("field %s not found in JSON response", field)
+			}
+		}
+	}
+
+	switch v := data.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return s.Parser.Parse(v)
+	default:
+		return 0, fmt.Errorf("unexpected JSON value for %s: %v", field, v)
+	}
+}
+
+func findElementByID(n *html.Node, id string) *html.Node {
+	if n.Type == html.ElementNode {
+		for _, attr := range n.Attr {
+			if attr.Key == "id" && attr.Val == id {
+				return n
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElementByID(c, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findTableRow returns the cells of the first table row whose text contains
+// text, ignoring case, or nil.
+func findTableRow(n *html.Node, text string) []*html.Node {
+	if n.Type == html.ElementNode && n.Data == "tr" &&
+		strings.Contains(strings.ToLower(nodeText(n)), strings.ToLower(text)) {
+		var cells []*html.Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+				cells = append(cells, c)
+			}
+		}
+		return cells
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if cells := findTableRow(c, text); cells != nil {
+			return cells
+		}
+	}
+	return nil
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+	}
+	return sb.String()
+}
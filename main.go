@@ -1,28 +1,83 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"strings"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/fatih/color"
 	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
 )
 
 type Config struct {
-	Client           *whatsmeow.Client
-	Connected        bool
-	DesiredMinRate   float64
-	DesiredMaxRate   float64
-	NotifyTarget     string
-	IsGroup          bool
-	LastNotifiedRate float64
+	Client     *whatsmeow.Client
+	DB         *sql.DB
+	History    *RateHistory
+	Connected  atomic.Bool
+	Pairs      []*CurrencyPair
+	Rules      []*AlertRule
+	Digests    []*Digest
+	QuietHours []*QuietHours
+	AlertState *AlertStateStore
+	// NotifyTargets are the phone numbers, group names and group IDs alerts
+	// go to unless a rule names its own.
+	NotifyTargets []string
+	Notifiers     map[string]Notifier // by kind, see splitTarget
+	Outbox        *Outbox
+	SourceMode    string
+	Interval      time.Duration
+	// Polling varies the interval with the time of day, holidays and how
+	// close the rates are to a threshold.
+	Polling *PollSchedule
+	// Location is the timezone alert messages show times in.
+	Location *time.Location
+
+	DBPath        string
+	RetentionDays int
+	PIDFile       string
+	// ShowDeadLetters prints the failed notifications and exits.
+	ShowDeadLetters bool
+	Listen          string
+
+	// BotAllowed lists the phone numbers and group IDs allowed to send bot
+	// commands, besides this account itself.
+	BotAllowed []string
+
+	// Subscriptions holds the alert bands people set for themselves by
+	// direct message; SubscriptionsOpen lets anyone, not just BotAllowed,
+	// subscribe.
+	Subscriptions     *SubscriptionStore
+	SubscriptionsOpen bool
+
+	// DerivedPairs are computed from the fetched pairs and added to Pairs
+	// after them.
+	DerivedPairs []DerivedFileConfig
+
+	// Providers are compared with the monitored pairs on every fetch, by
+	// their effective rate for a transfer of TransferAmount. When it is set
+	// the amount received is also shown with every rate.
+	Providers      []*Provider
+	TransferAmount float64
+
+	// mu guards the pair thresholds, which the HTTP API and bot commands can
+	// change while monitoring, BotAllowed and the fields below.
+	mu          sync.RWMutex
+	recipients  map[string]types.JID // resolved notification targets
+	latest      map[string]Quote
+	comparisons map[string][]Quote // by pair, see recordComparison
+	lastFetch   time.Time
+	pausedUntil time.Time
 }
 
 var (
@@ -31,194 +86,436 @@ var (
 )
 
 func main() {
-    // Set up logger
-    logger = log.New(os.Stdout, "CIMB Go: ", log.Ldate|log.Ltime)
-
-    // Print application information
-    printAppInfo()
-
-    // Set up WhatsApp client
-    //setupWhatsAppClient(&config)
-    err := setupWhatsAppClient(&config)
-    if err != nil {
-        logger.Fatalf("Failed to set up WhatsApp client: %v", err)
-    }
-
-    // Set up signal handling for graceful shutdown
-    signalChan := make(chan os.Signal, 1)
-    signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
-
-    //defer killAllChromeInstances()
-
-    for {
-        choice := showMainMenu()
-        switch choice {
-        case "1":
-            listJoinedGroups(&config)
-        case "2":
-            startProgram(signalChan)
-	case "h","H":
-            helpInfo()
-        case "q", "Q":
-            logger.Println("Exiting program...")
-            return
-        default:
-            logger.Println("Invalid choice. Please try again.")
-        }
-    }
+	os.Exit(run())
 }
 
-func showMainMenu() string {
-    fmt.Println("\nMain Menu:")
-    fmt.Println("1. List joined WhatsApp groups")
-    fmt.Println("2. Start program")
-    fmt.Println("H. How to use")
-    fmt.Println("Q. Quit")
-    fmt.Print("Enter your choice: ")
-	
-    scanner := bufio.NewScanner(os.Stdin)
-    scanner.Scan()
-    return scanner.Text()
+func run() int {
+	// Set up logger
+	logger = log.New(os.Stdout, "CIMB Go: ", log.Ldate|log.Ltime)
+
+	interactive, err := parseCommandLine(&config, os.Args[1:])
+	if err != nil {
+		logger.Printf("Invalid configuration: %v", err)
+		return exitConfigError
+	}
+	if !interactive && !config.ShowDeadLetters {
+		if err := validateConfig(&config); err != nil {
+			logger.Printf("Invalid configuration: %v", err)
+			return exitConfigError
+		}
+	}
+
+	// Root context, cancelled on SIGINT/SIGTERM. Everything that waits
+	// (prompts, fetches, Chrome, WhatsApp retries) stops when it is done.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if config.PIDFile != "" {
+		if err := writePIDFile(config.PIDFile); err != nil {
+			logger.Printf("Error: %v", err)
+			return exitFailure
+		}
+		defer removePIDFile(config.PIDFile)
+	}
+
+	// Print application information
+	if interactive {
+		printAppInfo()
+		stdin = newConsole(os.Stdin)
+	}
+
+	// Open the database shared by WhatsApp and the rate history
+	db, err := openDatabase(config.DBPath)
+	if err != nil {
+		logger.Printf("Failed to open database: %v", err)
+		return exitFailure
+	}
+	defer db.Close()
+	config.DB = db
+
+	config.History, err = NewRateHistory(db, time.Duration(config.RetentionDays)*24*time.Hour)
+	if err != nil {
+		logger.Printf("Failed to set up rate history: %v", err)
+		return exitFailure
+	}
+
+	config.AlertState, err = NewAlertStateStore(db)
+	if err != nil {
+		logger.Printf("Failed to set up alert state: %v", err)
+		return exitFailure
+	}
+
+	config.Subscriptions, err = NewSubscriptionStore(db)
+	if err != nil {
+		logger.Printf("Failed to set up subscriptions: %v", err)
+		return exitFailure
+	}
+
+	config.Outbox, err = NewOutbox(db)
+	if err != nil {
+		logger.Printf("Failed to set up notification outbox: %v", err)
+		return exitFailure
+	}
+	if config.ShowDeadLetters {
+		printDeadLetters(&config)
+		return exitOK
+	}
+
+	// Set up WhatsApp client
+	err = setupWhatsAppClient(ctx, &config)
+	if err != nil {
+		logger.Printf("Failed to set up WhatsApp client: %v", err)
+		return exitFailure
+	}
+	defer config.Client.Disconnect()
+	resolveBotAllowed(&config)
+
+	// Deliver queued notifications, including any left from the last run
+	go runOutbox(ctx, &config)
+	go runDigests(ctx, &config)
+
+	// Make sure no Chrome started by us outlives the program
+	defer killAllChromeInstances()
+
+	if config.Listen != "" {
+		go func() {
+			if err := serveAPI(ctx, config.Listen, &config); err != nil {
+				logger.Printf("HTTP API stopped: %v", err)
+			}
+		}()
+	}
+
+	if !interactive {
+		// Started from a config file or flags: monitor straight away
+		if err := resolveTargets(&config); err != nil {
+			logger.Printf("Invalid notification targets: %v", err)
+			return exitConfigError
+		}
+		printSettings()
+		runMonitor(ctx, false)
+		logger.Println("Shutting down...")
+		return exitOK
+	}
+
+	for {
+		choice, err := showMainMenu(ctx)
+		if err != nil {
+			logger.Println("Exiting program...")
+			return exitOK
+		}
+		switch choice {
+		case "1":
+			listJoinedGroups(&config)
+		case "2":
+			startProgram(ctx)
+		case "3":
+			printDeadLetters(&config)
+		case "h", "H":
+			helpInfo()
+		case "q", "Q":
+			logger.Println("Exiting program...")
+			return exitOK
+		default:
+			logger.Println("Invalid choice. Please try again.")
+		}
+	}
 }
 
-func startProgram(signalChan chan os.Signal) {
-    redColor := color.New(color.FgRed).SprintfFunc()
-
-    // Set up user preferences
-    setupUserPreferences()
-
-    // Previous label value
-    var prevRate float64
-
-    // Create initial context
-    ctx, cancel := createChromeContext()
-    defer cancel()
-
-    // Create a channel to signal program restart
-    restartChan := make(chan bool)
-
-    // Start input checker in a separate goroutine
-    go checkForRestart(restartChan)
-
-    // Create a ticker for 1-minute intervals
-    ticker := time.NewTicker(1 * time.Minute)
-    defer ticker.Stop()
-
-    fmt.Println(redColor("Program started.... Press 's' or 'S' and Enter at any time to restart."))
-
-    // Perform initial fetch
-    err := fetchAndPrintLabelWithRetry(ctx, &prevRate, &config)
-    if err != nil {
-        logger.Printf("Initial fetch error: %v", err)
-    }
-
-    for {
-        select {
-        case <-ticker.C:
-            // Fetch and print label every 1 minute
-            err := fetchAndPrintLabelWithRetry(ctx, &prevRate, &config)
-            if err != nil {
-                logger.Printf("Error after retries: %v. Recreating Chrome context.", err)
-                cancel()
-                ctx, cancel = createChromeContext()
-            }
-        case <-restartChan:
-            logger.Println("Restarting program...")
-            cancel()
-            killAllChromeInstances()
-            return
-        case <-signalChan:
-            logger.Println("Received interrupt signal. Shutting down...")
-            cancel()
-            killAllChromeInstances()
-            return
-        case <-ctx.Done():
-            // Exit if the context is done
-            return
-        default:
-            // Small sleep to prevent CPU hogging
-            time.Sleep(100 * time.Millisecond)
-        }
-    }
+func showMainMenu(ctx context.Context) (string, error) {
+	fmt.Println("\nMain Menu:")
+	fmt.Println("1. List joined WhatsApp groups")
+	fmt.Println("2. Start program")
+	fmt.Println("3. Show failed notifications")
+	fmt.Println("H. How to use")
+	fmt.Println("Q. Quit")
+	fmt.Print("Enter your choice: ")
+
+	return stdin.readLine(ctx)
 }
 
-func checkForRestart(restartChan chan<- bool) {
-    scanner := bufio.NewScanner(os.Stdin)
-    for scanner.Scan() {
-        input := scanner.Text()
-        if input == "s" || input == "S" {
-            restartChan <- true
-            return
-        }
-    }
-    if err := scanner.Err(); err != nil {
-        logger.Printf("Error reading standard input: %v", err)
-    }
+func startProgram(ctx context.Context) {
+	// Set up user preferences
+	if err := setupUserPreferences(ctx); err != nil {
+		return
+	}
+
+	runMonitor(ctx, true)
 }
 
-func setupUserPreferences() {
-	scanner := bufio.NewScanner(os.Stdin)
-	hiCyanColor := color.New(color.FgHiCyan).SprintfFunc()
-	
-	// Get desired minimum rate
-	for {
-		fmt.Print("Enter desired minimum rate: ")
-		scanner.Scan()
-		input := scanner.Text()
+// runMonitor polls every configured pair until ctx is cancelled. When
+// interactive it also watches stdin for 's' to return to the main menu.
+func runMonitor(ctx context.Context, interactive bool) {
+	redColor := color.New(color.FgRed).SprintfFunc()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// One rate source per pair, all sharing a single Chrome instance when
+	// Chrome is needed
+	browser := &chromeBrowser{parent: ctx}
+	defer browser.close()
+
+	// Without configured rules each pair alerts on its own desired range
+	rules := config.Rules
+	if len(rules) == 0 {
 		var err error
-		config.DesiredMinRate, err = strconv.ParseFloat(input, 64)
-		if err == nil {
-			break
+		if rules, err = defaultRules(config.Pairs); err != nil {
+			logger.Printf("Error: %v", err)
+			return
 		}
-		logger.Println("Invalid input. Please enter a valid number.")
 	}
+	loadRuleStates(config.AlertState, rules)
+
+	var monitored []*monitoredPair
+	for _, pair := range config.Pairs {
+		m := &monitoredPair{pair: pair, rules: rulesForPair(rules, pair)}
+		var derived *derivedSource
+		if pair.Derived != nil {
+			derived = &derivedSource{config: &config, pair: pair}
+			m.source = derived
+		} else {
+			source, err := newRateSource(config.SourceMode, pair, browser)
+			if err != nil {
+				logger.Printf("Error: %v", err)
+				return
+			}
+			m.source = source
+		}
+
+		// Restore the baseline from history so a restart keeps the colours
+		// right, and a derived rate is not recorded twice
+		if last, ok, err := config.History.Latest(pair.Name()); err != nil {
+			logger.Printf("Error: %v", err)
+		} else if ok {
+			m.prevRate = last.Rate
+			if derived != nil {
+				derived.last = last.Timestamp
+			}
+		}
+		monitored = append(monitored, m)
+	}
+
+	var providers []*providerSource
+	for _, provider := range config.Providers {
+		if findPair(config.Pairs, provider.Pair) == nil {
+			logger.Printf("Not comparing %s: %s is not being monitored", provider.Name, provider.Pair)
+			continue
+		}
+		source, err := newProviderSource(config.SourceMode, provider, browser)
+		if err != nil {
+			logger.Printf("Error: %v", err)
+			return
+		}
+		providers = append(providers, source)
+	}
+
+	// Create a channel to signal program restart. It stays nil (never ready)
+	// when not interactive, as there is no console to read from.
+	var restartChan chan bool
+	if interactive {
+		restartChan = make(chan bool, 1)
+
+		// Start input checker in a separate goroutine
+		go checkForRestart(ctx, restartChan)
+	}
+
+	// Apply rate history retention hourly
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
+	pruneHistory(config.History)
+
+	if interactive {
+		fmt.Println(redColor("Program started.... Press 's' or 'S' and Enter at any time to restart."))
+	} else {
+		logger.Printf("Monitoring started, fetching about every %v", config.Interval)
+	}
+
+	// Perform initial fetch
+	fetchAllPairs(ctx, monitored, providers, &config)
+
+	// The wait before each fetch comes from the polling schedule
+	timer := time.NewTimer(config.Polling.next(&config, rules, time.Now()))
+	defer timer.Stop()
 
-	// Get desired maximum rate
 	for {
-		fmt.Print("Enter desired maximum rate: ")
-		scanner.Scan()
-		input := scanner.Text()
-		var err error
-		config.DesiredMaxRate, err = strconv.ParseFloat(input, 64)
-		if err == nil && config.DesiredMaxRate > config.DesiredMinRate {
-			break
+		select {
+		case <-timer.C:
+			// Fetch and print every pair, then wait for the next fetch
+			fetchAllPairs(ctx, monitored, providers, &config)
+			timer.Reset(config.Polling.next(&config, rules, time.Now()))
+		case <-pruneTicker.C:
+			pruneHistory(config.History)
+		case <-restartChan:
+			logger.Println("Restarting program...")
+			return
+		case <-ctx.Done():
+			logger.Println("Received interrupt signal. Shutting down...")
+			return
 		}
+	}
+}
+
+// fetchAllPairs fetches, prints and alerts on every monitored pair in turn,
+// compares them with the other providers, then checks for stale data. A pair
+// that keeps failing has its source reset without affecting the others.
+func fetchAllPairs(ctx context.Context, monitored []*monitoredPair, providers []*providerSource, config *Config) {
+	for _, m := range monitored {
+		if ctx.Err() != nil {
+			return
+		}
+		// Derived pairs only change with the pairs they come from, so
+		// there is nothing to retry
+		if m.pair.Derived != nil {
+			if err := fetchAndPrintLabel(ctx, m, config); err != nil && !errors.Is(err, errDerivedUnchanged) {
+				logger.Printf("Error: %v", err)
+			}
+			continue
+		}
+		if err := fetchAndPrintLabelWithRetry(ctx, m, config); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Printf("Error after retries: %v. Resetting rate source.", err)
+			resetSource(m.source)
+		}
+	}
+
+	compareProviders(ctx, config, providers)
+
+	now := time.Now()
+	for _, m := range monitored {
+		evaluateProviderRules(ctx, config, m.rules, m.pair, now)
+		evaluateStaleRules(ctx, config, m.rules, m.pair, now)
+	}
+}
+
+func pruneHistory(history *RateHistory) {
+	removed, err := history.Prune(time.Now())
+	if err != nil {
+		logger.Printf("Error: %v", err)
+	} else if removed > 0 {
+		logger.Printf("Pruned %d old rate history entries", removed)
+	}
+}
+
+func checkForRestart(ctx context.Context, restartChan chan<- bool) {
+	for {
+		input, err := stdin.readLine(ctx)
 		if err != nil {
-			logger.Println("Invalid input. Please enter a valid number.")
-		} else {
-			logger.Println("Maximum rate must be greater than minimum rate. Please try again.")
+			return
+		}
+		if input == "s" || input == "S" {
+			restartChan <- true
+			return
 		}
 	}
+}
+
+// setupUserPreferences prompts for the pairs, thresholds and target. It
+// returns an error only when input is abandoned (shutdown or stdin closed).
+func setupUserPreferences(ctx context.Context) error {
+	var pairs []*CurrencyPair
+
+	// Get currency pairs to monitor
+	for {
+		fmt.Print("Enter currency pairs to monitor, comma-separated (e.g. SGD/MYR,SGD/IDR) [SGD/MYR]: ")
+		input, err := stdin.readLine(ctx)
+		if err != nil {
+			return err
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			input = "SGD/MYR"
+		}
+		pairs, err = parsePairList(input)
+		if err == nil {
+			break
+		}
+		logger.Printf("Invalid input: %v", err)
+	}
+
+	for _, pair := range pairs {
+		// Get desired minimum rate
+		for {
+			fmt.Printf("Enter desired minimum rate for %s: ", pair.Name())
+			input, err := stdin.readLine(ctx)
+			if err != nil {
+				return err
+			}
+			pair.DesiredMinRate, err = strconv.ParseFloat(input, 64)
+			if err == nil {
+				break
+			}
+			logger.Println("Invalid input. Please enter a valid number.")
+		}
 
-	// Get WhatsApp target
-	fmt.Println("Enter WhatsApp target:")
-	fmt.Println("- For personal notifications, enter a phone number (e.g., 60123456789)")
-	fmt.Println("- For group notifications, enter the group name or group ID")
-	fmt.Print("Your input: ")
-	scanner.Scan()
-	config.NotifyTarget = strings.TrimSpace(scanner.Text())
+		// Get desired maximum rate
+		for {
+			fmt.Printf("Enter desired maximum rate for %s: ", pair.Name())
+			input, err := stdin.readLine(ctx)
+			if err != nil {
+				return err
+			}
+			pair.DesiredMaxRate, err = strconv.ParseFloat(input, 64)
+			if err == nil && pair.DesiredMaxRate > pair.DesiredMinRate {
+				break
+			}
+			if err != nil {
+				logger.Println("Invalid input. Please enter a valid number.")
+			} else {
+				logger.Println("Maximum rate must be greater than minimum rate. Please try again.")
+			}
+		}
+	}
 
-	// Determine if it's a group or personal number
-	config.IsGroup = isGroupIdentifier(config.NotifyTarget)
+	config.mu.Lock()
+	config.Pairs = pairs
+	config.mu.Unlock()
 
-	if config.IsGroup {
-		matchedGroupID, err := matchGroupID(config.Client, config.NotifyTarget)
+	// Get WhatsApp targets, asking again until every one resolves
+	for {
+		fmt.Println("Enter WhatsApp targets, separated by commas:")
+		fmt.Println("- For personal notifications, enter a phone number (e.g., 60123456789)")
+		fmt.Println("- For group notifications, enter the group name or group ID")
+		fmt.Print("Your input: ")
+		input, err := stdin.readLine(ctx)
 		if err != nil {
-			logger.Printf("Error: %v\n", err)
-			logger.Println("Setting target to personal WhatsApp number.")
-			config.IsGroup = false
-		} else {
-			config.NotifyTarget = matchedGroupID
-			logger.Printf("Matched group ID: %s\n", config.NotifyTarget)
-			logger.Println("Target set to WhatsApp group")
+			return err
 		}
-	} else {
-		logger.Println("Target set to personal WhatsApp number:", config.NotifyTarget)
+		config.NotifyTargets = splitTargets(input)
+		if len(config.NotifyTargets) == 0 {
+			logger.Println("Please enter at least one target.")
+			continue
+		}
+		if err := resolveTargets(&config); err != nil {
+			logger.Printf("Error: %v", err)
+			continue
+		}
+		break
 	}
 
+	printSettings()
+	return nil
+}
+
+func printSettings() {
+	hiCyanColor := color.New(color.FgHiCyan).SprintfFunc()
+
 	// Confirm settings
 	fmt.Println(hiCyanColor("\nCurrent settings:"))
-	fmt.Println(hiCyanColor("Minimum Rate: %.4f", config.DesiredMinRate))
-	fmt.Println(hiCyanColor("Maximum Rate: %.4f", config.DesiredMaxRate))
-	fmt.Println(hiCyanColor("Notification Target: %s (%s)\n", config.NotifyTarget, map[bool]string{true: "Group", false: "Personal"}[config.IsGroup]))
+	for _, t := range config.thresholds() {
+		fmt.Println(hiCyanColor("%s Minimum Rate: %.4f", t.Pair, t.Min))
+		fmt.Println(hiCyanColor("%s Maximum Rate: %.4f", t.Pair, t.Max))
+	}
+	for _, target := range config.NotifyTargets {
+		kind, address := splitTarget(target)
+		if kind == notifierWhatsApp {
+			kind = "Personal"
+			if jid, err := config.recipient(address); err == nil && jid.Server == types.GroupServer {
+				kind = "Group"
+			}
+		}
+		fmt.Println(hiCyanColor("Notification Target: %s (%s)", target, kind))
+	}
+	fmt.Println()
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is a Prometheus counter or gauge with a fixed set of label names,
+// written out in the text exposition format by the /metrics endpoint.
+type metric struct {
+	name   string
+	help   string
+	kind   string // "counter" or "gauge"
+	labels []string
+	// value, when set, is read at scrape time instead of the stored samples.
+	value func() float64
+
+	mu      sync.Mutex
+	samples map[string]float64 // keyed by the rendered label set
+}
+
+var registeredMetrics []*metric
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func newMetric(kind, name, help string, labels ...string) *metric {
+	m := &metric{name: name, help: help, kind: kind, labels: labels, samples: make(map[string]float64)}
+	registeredMetrics = append(registeredMetrics, m)
+	return m
+}
+
+func newCounter(name, help string, labels ...string) *metric {
+	return newMetric("counter", name, help, labels...)
+}
+
+func newGauge(name, help string, labels ...string) *metric {
+	return newMetric("gauge", name, help, labels...)
+}
+
+func newGaugeFunc(name, help string, value func() float64) *metric {
+	m := newMetric("gauge", name, help)
+	m.value = value
+	return m
+}
+
+func (m *metric) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+func (m *metric) Add(v float64, labelValues ...string) {
+	key := m.labelSet(labelValues)
+	m.mu.Lock()
+	m.samples[key] += v
+	m.mu.Unlock()
+}
+
+func (m *metric) Set(v float64, labelValues ...string) {
+	key := m.labelSet(labelValues)
+	m.mu.Lock()
+	m.samples[key] = v
+	m.mu.Unlock()
+}
+
+func (m *metric) labelSet(values []string) string {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", m.name, len(values), len(m.labels)))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(values))
+	for i, v := range values {
+		pairs[i] = m.labels[i] + `="` + labelEscaper.Replace(v) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *metric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	if m.value != nil {
+		fmt.Fprintf(w, "%s %s\n", m.name, formatMetricValue(m.value()))
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.samples))
+	for k := range m.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", m.name, k, formatMetricValue(m.samples[k]))
+	}
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range registeredMetrics {
+		m.write(w)
+	}
+}
+
+var (
+	rateGauge = newGauge("cimb_rate",
+		"Latest fetched exchange rate.", "pair")
+	providerRateGauge = newGauge("cimb_provider_rate",
+		"Latest rate fetched from each compared provider.", "pair", "provider")
+	fetchAttempts = newCounter("cimb_fetch_attempts_total",
+		"Rate fetch attempts, by retry attempt number.", "pair", "attempt")
+	fetchFailures = newCounter("cimb_fetch_failures_total",
+		"Failed rate fetch attempts, by retry attempt number.", "pair", "attempt")
+	lastFetchGauge = newGauge("cimb_last_fetch_timestamp_seconds",
+		"Unix time of the last successful fetch.", "pair")
+	chromeRecreations = newCounter("cimb_chrome_context_recreations_total",
+		"Times the headless Chrome context was torn down and recreated.")
+	whatsappNotifications = newCounter("cimb_whatsapp_notifications_total",
+		"WhatsApp notifications by result: sent, failed, skipped, fallback_self or fallback_failed.", "result")
+	notifications = newCounter("cimb_notifications_total",
+		"Alert notifications by notifier and result: sent, failed, dead_letter, held or suppressed.", "notifier", "result")
+	_ = newGaugeFunc("cimb_whatsapp_connected",
+		"1 when the WhatsApp client is connected, 0 otherwise.",
+		func() float64 {
+			if config.Connected.Load() {
+				return 1
+			}
+			return 0
+		})
+)
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notifier kinds, used as the prefix of a target such as
+// "telegram:123456789". A target without a known prefix is a WhatsApp target.
+const (
+	notifierWhatsApp = "whatsapp"
+	notifierEmail    = "email"
+	notifierTelegram = "telegram"
+	notifierSlack    = "slack"
+	notifierWebhook  = "webhook"
+)
+
+// Notification is one alert to deliver. Target is the address part of the
+// rule target, e.g. the phone number or email address.
+type Notification struct {
+	Target  string    `json:"target,omitempty"`
+	Message string    `json:"message"`
+	Rule    string    `json:"rule,omitempty"`
+	Pair    string    `json:"pair,omitempty"`
+	Rate    float64   `json:"rate,omitempty"`
+	Time    time.Time `json:"time"`
+	// Chart, when set, asks for a rate chart with Message as its caption.
+	// Notifiers that cannot send images send just the message.
+	Chart *ChartRequest `json:"chart,omitempty"`
+	// Urgent notifications are delivered even during quiet hours.
+	Urgent bool `json:"urgent,omitempty"`
+}
+
+// Notifier delivers alerts over one channel (WhatsApp, email, a chat
+// service's API, a webhook).
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NotifiersFileConfig configures the notifiers besides WhatsApp, which is
+// always available. Only the ones present can be used as targets.
+type NotifiersFileConfig struct {
+	Email    *EmailNotifier    `json:"email,omitempty"`
+	Telegram *TelegramNotifier `json:"telegram,omitempty"`
+	Slack    *SlackNotifier    `json:"slack,omitempty"`
+	Webhook  *WebhookNotifier  `json:"webhook,omitempty"`
+}
+
+// preparedNotifier is a notifier whose settings come from the config file
+// and are checked before use.
+type preparedNotifier interface {
+	Notifier
+	prepare() error
+}
+
+// apply validates each configured notifier and adds it to notifiers.
+func (nc *NotifiersFileConfig) apply(notifiers map[string]Notifier) error {
+	var configured []preparedNotifier
+	if nc.Email != nil {
+		configured = append(configured, nc.Email)
+	}
+	if nc.Telegram != nil {
+		configured = append(configured, nc.Telegram)
+	}
+	if nc.Slack != nil {
+		configured = append(configured, nc.Slack)
+	}
+	if nc.Webhook != nil {
+		configured = append(configured, nc.Webhook)
+	}
+
+	for _, notifier := range configured {
+		if err := notifier.prepare(); err != nil {
+			return fmt.Errorf("%s notifier: %v", notifier.Name(), err)
+		}
+		notifiers[notifier.Name()] = notifier
+	}
+	return nil
+}
+
+// splitTarget splits a rule target into the notifier kind and the address
+// given to it. Targets without a notifier prefix go to WhatsApp.
+func splitTarget(target string) (kind, address string) {
+	if k, address, ok := strings.Cut(target, ":"); ok {
+		switch k = strings.ToLower(k); k {
+		case notifierWhatsApp, notifierEmail, notifierTelegram, notifierSlack, notifierWebhook:
+			return k, strings.TrimSpace(address)
+		}
+	}
+	return notifierWhatsApp, target
+}
+
+// notify queues n for delivery to target. The outbox worker delivers it.
+func notify(config *Config, target string, n Notification) {
+	if err := config.Outbox.Enqueue(target, n); err != nil {
+		logger.Printf("Error: %v", err)
+	}
+}
+
+// deliver makes one attempt to deliver n to target through the notifier the
+// target names.
+func deliver(ctx context.Context, config *Config, target string, n Notification) error {
+	kind, address := splitTarget(target)
+	notifier := config.Notifiers[kind]
+	if notifier == nil {
+		return fmt.Errorf("no %s notifier configured", kind)
+	}
+
+	n.Target = address
+	return notifier.Notify(ctx, n)
+}
+
+// WhatsAppNotifier sends alerts with the logged-in WhatsApp account.
+type WhatsAppNotifier struct {
+	config *Config
+}
+
+func (w *WhatsAppNotifier) Name() string {
+	return notifierWhatsApp
+}
+
+func (w *WhatsAppNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.Chart != nil {
+		image, err := chartImage(w.config, *n.Chart)
+		if err == nil {
+			return sendWhatsAppImage(ctx, w.config, n.Target, image, n.Message)
+		}
+		logger.Printf("Error: chart for %s: %v", n.Chart.Pair, err)
+	}
+	return sendWhatsAppNotification(ctx, w.config, n.Target, n.Message)
+}
+
+// notifierHTTPClient is shared by the notifiers that call HTTP APIs.
+var notifierHTTPClient = &http.Client{Timeout: 30 * time.Second}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Outbox is a persistent queue of notifications. Alerts are enqueued by the
+// monitor and delivered by runOutbox, so a slow or failing notifier never
+// holds up fetching, and nothing queued is lost on restart. A notification
+// that still fails after MaxAttempts is moved to the dead_letters table.
+type Outbox struct {
+	db          *sql.DB
+	MaxAttempts int
+	BaseDelay   time.Duration // wait after the first failure, doubled after each
+	MaxDelay    time.Duration
+
+	wake chan struct{}
+}
+
+// outboxEntry is a queued or dead-lettered notification.
+type outboxEntry struct {
+	ID           int64
+	Target       string
+	Notification Notification
+	Attempts     int
+	LastError    string
+	CreatedAt    time.Time
+	FailedAt     time.Time // dead letters only
+}
+
+func NewOutbox(db *sql.DB) (*Outbox, error) {
+	err := execSchema(db,
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			target          TEXT    NOT NULL,
+			notification    TEXT    NOT NULL,
+			attempts        INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at INTEGER NOT NULL,
+			last_error      TEXT    NOT NULL DEFAULT '',
+			created_at      INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS outbox_next_attempt ON outbox (next_attempt_at)`,
+		`CREATE TABLE IF NOT EXISTS dead_letters (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			target       TEXT    NOT NULL,
+			notification TEXT    NOT NULL,
+			attempts     INTEGER NOT NULL,
+			last_error   TEXT    NOT NULL,
+			created_at   INTEGER NOT NULL,
+			failed_at    INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS held_notifications (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			target       TEXT    NOT NULL,
+			notification TEXT    NOT NULL,
+			held_at      INTEGER NOT NULL
+		)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Outbox{
+		db:          db,
+		MaxAttempts: 8,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    30 * time.Minute,
+		wake:        make(chan struct{}, 1),
+	}, nil
+}
+
+// Enqueue queues n for delivery to target and wakes the worker.
+func (o *Outbox) Enqueue(target string, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %v", err)
+	}
+	now := time.Now().UnixMilli()
+	_, err = o.db.Exec(
+		`INSERT INTO outbox (target, notification, next_attempt_at, created_at) VALUES (?, ?, ?, ?)`,
+		target, string(data), now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue notification: %v", err)
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Due returns the queued notifications whose next attempt is due, oldest
+// first.
+func (o *Outbox) Due(now time.Time) ([]outboxEntry, error) {
+	rows, err := o.db.Query(
+		`SELECT id, target, notification, attempts, last_error, created_at FROM outbox
+		 WHERE next_attempt_at <= ? ORDER BY id`,
+		now.UnixMilli(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []outboxEntry
+	for rows.Next() {
+		e, err := scanOutboxEntry(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	return entries, nil
+}
+
+// Pending returns how many notifications are waiting in the outbox.
+func (o *Outbox) Pending() (int, error) {
+	var n int
+	if err := o.db.QueryRow(`SELECT COUNT(*) FROM outbox`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	return n, nil
+}
+
+func (o *Outbox) Delivered(id int64) error {
+	if _, err := o.db.Exec(`DELETE FROM outbox WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to update outbox: %v", err)
+	}
+	return nil
+}
+
+// Failed records a failed attempt. The entry is retried after an
+// exponentially growing delay, or moved to the dead letters once it has
+// used up its attempts; the boolean reports which.
+func (o *Outbox) Failed(e outboxEntry, sendErr error, now time.Time) (dead bool, err error) {
+	e.Attempts++
+	if e.Attempts < o.MaxAttempts {
+		_, err := o.db.Exec(
+			`UPDATE outbox SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?`,
+			e.Attempts, now.Add(o.backoff(e.Attempts)).UnixMilli(), sendErr.Error(), e.ID,
+		)
+		if err != nil {
+			return false, fmt.Errorf("failed to update outbox: %v", err)
+		}
+		return false, nil
+	}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to update outbox: %v", err)
+	}
+	defer tx.Rollback()
+
+	data, _ := json.Marshal(e.Notification)
+	_, err = tx.Exec(
+		`INSERT INTO dead_letters (target, notification, attempts, last_error, created_at, failed_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		e.Target, string(data), e.Attempts, sendErr.Error(), e.CreatedAt.UnixMilli(), now.UnixMilli(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to move notification to dead letters: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM outbox WHERE id = ?`, e.ID); err != nil {
+		return false, fmt.Errorf("failed to update outbox: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to move notification to dead letters: %v", err)
+	}
+	return true, nil
+}
+
+// Hold moves a queued notification aside until its target's quiet hours
+// end; see releaseHeld.
+func (o *Outbox) Hold(e outboxEntry, now time.Time) error {
+	tx, err := o.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to hold notification: %v", err)
+	}
+	defer tx.Rollback()
+
+	data, _ := json.Marshal(e.Notification)
+	_, err = tx.Exec(
+		`INSERT INTO held_notifications (target, notification, held_at) VALUES (?, ?, ?)`,
+		e.Target, string(data), now.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to hold notification: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM outbox WHERE id = ?`, e.ID); err != nil {
+		return fmt.Errorf("failed to hold notification: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to hold notification: %v", err)
+	}
+	return nil
+}
+
+// Held returns the held notifications by target, oldest first.
+func (o *Outbox) Held() (map[string][]outboxEntry, error) {
+	rows, err := o.db.Query(`SELECT id, target, notification, held_at FROM held_notifications ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read held notifications: %v", err)
+	}
+	defer rows.Close()
+
+	held := make(map[string][]outboxEntry)
+	for rows.Next() {
+		var (
+			e      outboxEntry
+			data   string
+			heldAt int64
+		)
+		if err := rows.Scan(&e.ID, &e.Target, &data, &heldAt); err != nil {
+			return nil, fmt.Errorf("failed to read held notifications: %v", err)
+		}
+		if err := json.Unmarshal([]byte(data), &e.Notification); err != nil {
+			return nil, fmt.Errorf("failed to decode held notification %d: %v", e.ID, err)
+		}
+		e.CreatedAt = time.UnixMilli(heldAt)
+		held[e.Target] = append(held[e.Target], e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read held notifications: %v", err)
+	}
+	return held, nil
+}
+
+// Release queues n for target in place of the held notifications ids.
+func (o *Outbox) Release(target string, ids []int64, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %v", err)
+	}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to release held notifications: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixMilli()
+	_, err = tx.Exec(
+		`INSERT INTO outbox (target, notification, next_attempt_at, created_at) VALUES (?, ?, ?, ?)`,
+		target, string(data), now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release held notifications: %v", err)
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM held_notifications WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to release held notifications: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to release held notifications: %v", err)
+	}
+	return nil
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (o *Outbox) backoff(attempts int) time.Duration {
+	delay := o.BaseDelay
+	for i := 1; i < attempts && delay < o.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, o.MaxDelay)
+}
+
+// DeadLetters returns the most recent dead letters, newest first.
+func (o *Outbox) DeadLetters(limit int) ([]outboxEntry, error) {
+	rows, err := o.db.Query(
+		`SELECT id, target, notification, attempts, last_error, created_at, failed_at FROM dead_letters
+		 ORDER BY id DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []outboxEntry
+	for rows.Next() {
+		e, err := scanOutboxEntry(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %v", err)
+	}
+	return entries, nil
+}
+
+func scanOutboxEntry(row scannable, dead bool) (outboxEntry, error) {
+	var (
+		e                   outboxEntry
+		data                string
+		createdAt, failedAt int64
+	)
+	dest := []interface{}{&e.ID, &e.Target, &data, &e.Attempts, &e.LastError, &createdAt}
+	if dead {
+		dest = append(dest, &failedAt)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return outboxEntry{}, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	if err := json.Unmarshal([]byte(data), &e.Notification); err != nil {
+		return outboxEntry{}, fmt.Errorf("failed to decode queued notification %d: %v", e.ID, err)
+	}
+	e.CreatedAt = time.UnixMilli(createdAt)
+	if dead {
+		e.FailedAt = time.UnixMilli(failedAt)
+	}
+	return e, nil
+}
+
+// runOutbox delivers queued notifications until ctx is cancelled. WhatsApp
+// notifications wait, without using up attempts, while the client is
+// disconnected.
+func runOutbox(ctx context.Context, config *Config) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		deliverDue(ctx, config)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-config.Outbox.wake:
+		}
+	}
+}
+
+func deliverDue(ctx context.Context, config *Config) {
+	now := time.Now()
+	releaseHeld(config, now)
+
+	entries, err := config.Outbox.Due(now)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return
+	}
+
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if quietHoursApply(config, e, now) {
+			continue
+		}
+		kind, _ := splitTarget(e.Target)
+		if kind == notifierWhatsApp && !config.Connected.Load() {
+			continue
+		}
+
+		err := deliver(ctx, config, e.Target, e.Notification)
+		if err == nil {
+			notifications.Inc(kind, "sent")
+			if err := config.Outbox.Delivered(e.ID); err != nil {
+				logger.Printf("Error: %v", err)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			// Shutting down: the entry stays queued for the next run.
+			return
+		}
+
+		notifications.Inc(kind, "failed")
+		dead, err2 := config.Outbox.Failed(e, err, time.Now())
+		if err2 != nil {
+			logger.Printf("Error: %v", err2)
+			continue
+		}
+		if !dead {
+			logger.Printf("Error: notification to %s failed (attempt %d): %v", e.Target, e.Attempts+1, err)
+			continue
+		}
+
+		logger.Printf("Error: giving up on notification to %s after %d attempts: %v", e.Target, e.Attempts+1, err)
+		notifications.Inc(kind, "dead_letter")
+		if kind == notifierWhatsApp {
+			sendToSelf(ctx, config, e.Notification.Message)
+		}
+	}
+}
+
+// sendToSelf sends a WhatsApp message that could not be delivered to its
+// target to this account instead, so it is not lost.
+func sendToSelf(ctx context.Context, config *Config, message string) {
+	if config.Client == nil || config.Client.Store.ID == nil {
+		return
+	}
+	selfJID := config.Client.Store.ID.ToNonAD()
+	if err := sendWhatsAppMessage(ctx, config, selfJID, message); err != nil {
+		logger.Printf("Failed to send fallback message to self: %v", err)
+		whatsappNotifications.Inc("fallback_failed")
+	} else {
+		logger.Println("Fallback message sent to self successfully")
+		whatsappNotifications.Inc("fallback_self")
+	}
+}
+
+// printDeadLetters lists the notifications that could not be delivered.
+func printDeadLetters(config *Config) {
+	redColor := color.New(color.FgRed).SprintfFunc()
+
+	entries, err := config.Outbox.DeadLetters(50)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return
+	}
+	if pending, err := config.Outbox.Pending(); err == nil {
+		fmt.Printf("Notifications waiting in the outbox: %d\n", pending)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No failed notifications.")
+		return
+	}
+
+	fmt.Printf("Failed notifications (latest %d):\n", len(entries))
+	for _, e := range entries {
+		fmt.Printf("\n#%d %s -> %s (%d attempts, queued %s)\n",
+			e.ID, e.FailedAt.Format("2006-01-02 15:04:05"), e.Target, e.Attempts, e.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Println(redColor("  Error: %s", e.LastError))
+		fmt.Printf("  Message: %s\n", e.Notification.Message)
+	}
+}
+
+// whatsAppTarget is the target that sends to a WhatsApp JID directly.
+func whatsAppTarget(jid types.JID) string {
+	return notifierWhatsApp + ":" + jid.String()
+}
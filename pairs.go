@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CurrencyPair is one exchange rate being monitored, together with where to
+// read it and the range outside of which an alert is sent.
+type CurrencyPair struct {
+	From     string
+	To       string
+	URL      string
+	Selector string
+	// Prefix is the label text in front of the rate, e.g. "SGD 1.00 = MYR ".
+	Prefix string
+	// Format is how to read the label when the prefix does not match.
+	Format RateFormat
+	// JSONURL and JSONField name a JSON endpoint serving the rate, read
+	// over plain HTTP instead of the page.
+	JSONURL   string
+	JSONField string
+	// Scripted is set when the page fills its label in with JavaScript, so
+	// that it can only be read in headless Chrome.
+	Scripted bool
+	// Fees are what CIMB charges on a transfer of this pair.
+	Fees FeeModel
+
+	// Derived is set for pairs computed from other pairs' rates rather than
+	// fetched. Label names them when "FROM/TO" would not do.
+	Derived *derivation
+	Label   string
+
+	DesiredMinRate float64
+	DesiredMaxRate float64
+}
+
+// Name returns the pair in "FROM/TO" form, e.g. "SGD/MYR", or its label.
+func (p *CurrencyPair) Name() string {
+	if p.Label != "" {
+		return p.Label
+	}
+	return p.From + "/" + p.To
+}
+
+// parser returns the parser for the pair's rate label.
+func (p *CurrencyPair) parser() *RateParser {
+	return &RateParser{Prefix: p.Prefix, Format: p.Format, From: p.From, To: p.To}
+}
+
+// knownPairs are the CIMB Clicks rate pages the program knows how to read
+// without extra configuration. Their labels are filled in by JavaScript, so
+// they are read in headless Chrome unless a json_url is configured.
+var knownPairs = []CurrencyPair{
+	{From: "SGD", To: "MYR", URL: "https://www.cimbclicks.com.sg/sgd-to-myr", Selector: "#rateStr", Prefix: "SGD 1.00 = MYR ", Scripted: true},
+	{From: "SGD", To: "IDR", URL: "https://www.cimbclicks.com.sg/sgd-to-idr", Selector: "#rateStr", Prefix: "SGD 1.00 = IDR ", Scripted: true},
+	{From: "SGD", To: "INR", URL: "https://www.cimbclicks.com.sg/sgd-to-inr", Selector: "#rateStr", Prefix: "SGD 1.00 = INR ", Scripted: true},
+	{From: "MYR", To: "SGD", URL: "https://www.cimbclicks.com.sg/myr-to-sgd", Selector: "#rateStr", Prefix: "MYR 1.00 = SGD ", Scripted: true},
+}
+
+// lookupPair returns a copy of the known pair matching name ("SGD/MYR",
+// "sgd-myr" and "SGDMYR" are all accepted).
+func lookupPair(name string) (*CurrencyPair, error) {
+	key := pairKey(name)
+	for _, p := range knownPairs {
+		if p.From+p.To == key {
+			pair := p
+			return &pair, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown currency pair: %s", name)
+}
+
+// findPair returns the configured pair with the given name, or nil.
+func findPair(pairs []*CurrencyPair, name string) *CurrencyPair {
+	key := pairKey(name)
+	for _, p := range pairs {
+		if pairKey(p.Name()) == key {
+			return p
+		}
+	}
+	return nil
+}
+
+func pairKey(name string) string {
+	return strings.ToUpper(strings.NewReplacer("/", "", "-", "", " ", "").Replace(name))
+}
+
+// parsePairList parses a comma-separated list of known pair names.
+func parsePairList(list string) ([]*CurrencyPair, error) {
+	var pairs []*CurrencyPair
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if findPair(pairs, name) != nil {
+			continue
+		}
+		pair, err := lookupPair(name)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no currency pairs given")
+	}
+	return pairs, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	defaultJitter           = 0.25
+	defaultOffHoursInterval = 15 * time.Minute
+	defaultNearInterval     = 20 * time.Second
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// PollSchedule decides how long to wait before the next fetch. Within the
+// active hours and days the configured interval is used, shortened to
+// NearInterval while a rate is within NearPercent of a threshold; outside
+// them, and on holidays, OffHoursInterval is used instead. Every wait is
+// randomised by Jitter, e.g. 0.25 turns 1m into 45-75s.
+type PollSchedule struct {
+	Jitter *float64 `json:"jitter,omitempty"`
+	// ActiveHours is a daily window such as "09:00-18:00"; always active
+	// when empty.
+	ActiveHours string `json:"active_hours,omitempty"`
+	// ActiveDays is a range or list of days such as "mon-fri" or
+	// "mon,wed,fri"; every day when empty.
+	ActiveDays string `json:"active_days,omitempty"`
+	// Holidays are built-in calendars ("SG") and extra dates
+	// ("2026-12-24") that are treated as inactive days.
+	Holidays []string `json:"holidays,omitempty"`
+	// Timezone for ActiveHours, ActiveDays and Holidays; the configured
+	// timezone when empty.
+	Timezone         string   `json:"timezone,omitempty"`
+	OffHoursInterval Duration `json:"off_hours_interval,omitempty"`
+	NearPercent      float64  `json:"near_percent,omitempty"`
+	NearInterval     Duration `json:"near_interval,omitempty"`
+
+	start, end int // minutes after midnight, equal when always active
+	days       map[time.Weekday]bool
+	holidays   map[string]string
+	location   *time.Location
+	mode       string // last reason logged, so changes are logged once
+}
+
+func (p *PollSchedule) prepare() error {
+	if p.Jitter == nil {
+		jitter := defaultJitter
+		p.Jitter = &jitter
+	}
+	if *p.Jitter < 0 || *p.Jitter >= 1 {
+		return fmt.Errorf("polling: jitter must be at least 0 and less than 1")
+	}
+
+	if p.ActiveHours != "" {
+		start, end, ok := strings.Cut(p.ActiveHours, "-")
+		if !ok {
+			return fmt.Errorf("polling: active hours must look like 09:00-18:00")
+		}
+		var err error
+		if p.start, err = parseClock(strings.TrimSpace(start)); err != nil {
+			return fmt.Errorf("polling: %v", err)
+		}
+		if p.end, err = parseClock(strings.TrimSpace(end)); err != nil {
+			return fmt.Errorf("polling: %v", err)
+		}
+	}
+
+	if p.ActiveDays != "" {
+		days, err := parseWeekdays(p.ActiveDays)
+		if err != nil {
+			return fmt.Errorf("polling: %v", err)
+		}
+		p.days = days
+	}
+
+	p.holidays = make(map[string]string)
+	for _, h := range p.Holidays {
+		if calendar, ok := holidayCalendars[strings.ToUpper(h)]; ok {
+			for date, name := range calendar {
+				p.holidays[date] = name
+			}
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, h); err != nil {
+			return fmt.Errorf("polling: %q is neither a holiday calendar nor a YYYY-MM-DD date", h)
+		}
+		p.holidays[h] = "holiday"
+	}
+
+	if p.Timezone != "" {
+		loc, err := time.LoadLocation(p.Timezone)
+		if err != nil {
+			return fmt.Errorf("polling: invalid timezone: %v", err)
+		}
+		p.location = loc
+	}
+
+	if p.OffHoursInterval < 0 || p.NearInterval < 0 || p.NearPercent < 0 {
+		return fmt.Errorf("polling: intervals and near_percent cannot be negative")
+	}
+	if p.OffHoursInterval == 0 {
+		p.OffHoursInterval = Duration(defaultOffHoursInterval)
+	}
+	if p.NearInterval == 0 {
+		p.NearInterval = Duration(defaultNearInterval)
+	}
+	return nil
+}
+
+// parseWeekdays parses "mon-fri", "sat,sun" and the like.
+func parseWeekdays(s string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, ok1 := weekdayNames[from]
+		last, ok2 := weekdayNames[to]
+		if !isRange {
+			last, ok2 = first, ok1
+		}
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid days %q, expected e.g. mon-fri", s)
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func (p *PollSchedule) in(config *Config, t time.Time) time.Time {
+	if p.location != nil {
+		return t.In(p.location)
+	}
+	return t.In(config.location())
+}
+
+// inactive returns why t is outside the active hours, or "" when it is not.
+func (p *PollSchedule) inactive(config *Config, t time.Time) string {
+	t = p.in(config, t)
+	if name, ok := p.holidays[t.Format(time.DateOnly)]; ok {
+		return name
+	}
+	if p.days != nil && !p.days[t.Weekday()] {
+		return "outside active days"
+	}
+	if p.start != p.end && !inQuietHours(clockString(p.start), clockString(p.end), t) {
+		return "outside active hours"
+	}
+	return ""
+}
+
+func clockString(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// nextActive returns when the active hours next begin after t, or the zero
+// time if not within two weeks.
+func (p *PollSchedule) nextActive(config *Config, t time.Time) time.Time {
+	local := p.in(config, t)
+	for d := 0; d <= 14; d++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+d, 0, 0, 0, 0, local.Location())
+		start := day.Add(time.Duration(p.start) * time.Minute)
+		if start.After(t) && p.inactive(config, start) == "" {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// nearThreshold reports whether the latest rate of any pair is within
+// NearPercent of its alert range or of a threshold rule's bounds.
+func (p *PollSchedule) nearThreshold(config *Config, rules []*AlertRule) bool {
+	if p.NearPercent <= 0 {
+		return false
+	}
+	latest := make(map[string]float64)
+	for _, q := range config.latestQuotes() {
+		latest[q.Pair] = q.Rate
+	}
+	near := func(pair string, level float64) bool {
+		rate, ok := latest[pair]
+		return ok && level > 0 && math.Abs(rate-level)/level*100 <= p.NearPercent
+	}
+
+	for _, t := range config.thresholds() {
+		if near(t.Pair, t.Min) || near(t.Pair, t.Max) {
+			return true
+		}
+	}
+	for _, rule := range rules {
+		if rule.Type == ruleThreshold && (near(rule.Pair, rule.Min) || near(rule.Pair, rule.Max)) {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns how long to wait before the fetch after one at now, and
+// logs whenever the reason for the interval changes.
+func (p *PollSchedule) next(config *Config, rules []*AlertRule, now time.Time) time.Duration {
+	interval, mode := config.Interval, "active"
+	if reason := p.inactive(config, now); reason != "" {
+		interval, mode = time.Duration(p.OffHoursInterval), reason
+		// Never sleep past the start of the active hours
+		if start := p.nextActive(config, now); !start.IsZero() && start.Sub(now) < interval {
+			interval = start.Sub(now)
+		}
+	} else if p.nearThreshold(config, rules) {
+		interval, mode = time.Duration(p.NearInterval), "near a threshold"
+	}
+
+	if mode != p.mode {
+		if p.mode != "" || mode != "active" {
+			logger.Printf("Polling every %v (%s)", interval.Round(time.Second), mode)
+		}
+		p.mode = mode
+	}
+
+	jitter := *p.Jitter * (2*rand.Float64() - 1)
+	return max(time.Duration(float64(interval)*(1+jitter)), time.Second)
+}
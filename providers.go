@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// cimbProvider names the monitored pairs' own quotes in comparisons.
+const cimbProvider = "CIMB"
+
+// Provider is another bank or remittance service whose rate for a pair is
+// compared with CIMB's. Its page is read like a pair's (an element ID, a
+// table row or a JSON field) and the rate normalised to units of To per
+// unit of From.
+type Provider struct {
+	Name      string
+	Pair      string
+	URL       string
+	Selector  string
+	Row       string
+	Column    int
+	JSONField string
+	FeeField  string
+	Prefix    string
+	Format    RateFormat
+
+	// Per is how many units the page quotes the rate for, e.g. 100 for
+	// "MYR 100 = SGD 30.52".
+	Per float64
+	// Inverse is set when the page quotes From per unit of To (SGD per
+	// MYR, as Singapore banks do) rather than To per From.
+	Inverse bool
+
+	// Fees are charged on each transfer. A fee read from FeeField replaces
+	// them.
+	Fees FeeModel
+}
+
+// knownProviders are the SGD to MYR providers that can be compared by name.
+// The money changer has no page of its own: give it the url, row and column
+// of the one you use.
+var knownProviders = []Provider{
+	{Name: "DBS", Pair: "SGD/MYR", URL: "https://www.dbs.com.sg/personal/rates-online/foreign-currency-foreign-exchange.page",
+		Row: "Malaysian Ringgit", Column: 2, Per: 100, Inverse: true},
+	{Name: "OCBC", Pair: "SGD/MYR", URL: "https://www.ocbc.com/personal-banking/investments/foreign-exchange-rates",
+		Row: "Malaysian Ringgit", Column: 2, Per: 100, Inverse: true},
+	{Name: "UOB", Pair: "SGD/MYR", URL: "https://www.uobgroup.com/online-rates/foreign-exchange-rates.page",
+		Row: "Malaysian Ringgit", Column: 2, Per: 100, Inverse: true},
+	{Name: "Wise", Pair: "SGD/MYR", URL: "https://wise.com/rates/live?source=SGD&target=MYR", JSONField: "value"},
+	{Name: "Money changer", Pair: "SGD/MYR", Row: "MYR", Column: 1},
+}
+
+// ProviderFileConfig configures one provider. Name may be a known provider,
+// whose settings any field given here overrides, or a new one with a url
+// and a selector, row or json_field.
+type ProviderFileConfig struct {
+	Name      string  `json:"name"`
+	Pair      string  `json:"pair,omitempty"`
+	URL       string  `json:"url,omitempty"`
+	Selector  string  `json:"selector,omitempty"`
+	Row       string  `json:"row,omitempty"`
+	Column    *int    `json:"column,omitempty"`
+	JSONField string  `json:"json_field,omitempty"`
+	FeeField  string  `json:"fee_field,omitempty"`
+	Prefix    string  `json:"prefix,omitempty"`
+	Per       float64 `json:"per,omitempty"`
+	Inverse   *bool   `json:"inverse,omitempty"`
+	FeeFileConfig
+	RateFormatFileConfig
+}
+
+// lookupProvider returns a copy of the known provider named name, ignoring
+// case.
+func lookupProvider(name string) (*Provider, error) {
+	for _, p := range knownProviders {
+		if strings.EqualFold(p.Name, strings.TrimSpace(name)) {
+			provider := p
+			return &provider, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown provider: %s", name)
+}
+
+// parseProviderList parses a comma-separated list of known provider names.
+func parseProviderList(list string) ([]*Provider, error) {
+	var providers []*Provider
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		provider, err := lookupProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := provider.validate(); err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+func (pc ProviderFileConfig) toProvider() (*Provider, error) {
+	provider, err := lookupProvider(pc.Name)
+	if err != nil {
+		if pc.Name == "" {
+			return nil, fmt.Errorf("provider: name is required")
+		}
+		provider = &Provider{Name: pc.Name, Pair: "SGD/MYR"}
+	}
+	if pc.Pair != "" {
+		pair, err := lookupPair(pc.Pair)
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %v", pc.Name, err)
+		}
+		provider.Pair = pair.Name()
+	}
+	for _, field := range []struct {
+		value string
+		into  *string
+	}{
+		{pc.URL, &provider.URL},
+		{pc.Selector, &provider.Selector},
+		{pc.Row, &provider.Row},
+		{pc.JSONField, &provider.JSONField},
+		{pc.FeeField, &provider.FeeField},
+		{pc.Prefix, &provider.Prefix},
+	} {
+		if field.value != "" {
+			*field.into = field.value
+		}
+	}
+	if pc.Column != nil {
+		provider.Column = *pc.Column
+	}
+	if pc.Inverse != nil {
+		provider.Inverse = *pc.Inverse
+	}
+	if pc.Per != 0 {
+		provider.Per = pc.Per
+	}
+	if provider.Fees, err = pc.toFeeModel(); err != nil {
+		return nil, fmt.Errorf("provider %q: %v", pc.Name, err)
+	}
+	if provider.Format, err = pc.toRateFormat(); err != nil {
+		return nil, fmt.Errorf("provider %q: %v", pc.Name, err)
+	}
+
+	if err := provider.validate(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+func (p *Provider) validate() error {
+	if p.URL == "" {
+		return fmt.Errorf("provider %q: url is required", p.Name)
+	}
+	if p.Selector == "" && p.Row == "" && p.JSONField == "" {
+		return fmt.Errorf("provider %q: one of selector, row or json_field is required", p.Name)
+	}
+	if p.Per < 0 {
+		return fmt.Errorf("provider %q: per must be positive", p.Name)
+	}
+	return nil
+}
+
+// providerSource fetches a provider's page and normalises what it quotes.
+type providerSource struct {
+	provider *Provider
+	source   RateSource
+}
+
+// newProviderSource builds the source for a provider. JSON endpoints are
+// always fetched over plain HTTP; pages follow the configured source mode.
+func newProviderSource(mode string, p *Provider, browser *chromeBrowser) (*providerSource, error) {
+	page := NewHTTPRateSource(p.URL, p.Selector, p.parser())
+	page.Row, page.Column = p.Row, p.Column
+	page.JSONField, page.FeeField = p.JSONField, p.FeeField
+	chrome := NewChromeRateSource(browser, p.URL, p.Selector, p.parser())
+	chrome.Row, chrome.Column = p.Row, p.Column
+
+	var source RateSource
+	switch {
+	case p.JSONField != "" || mode == "http":
+		source = page
+	case mode == "chrome":
+		source = chrome
+	case mode == "auto" || mode == "":
+		source = &fallbackRateSource{primary: page, fallback: chrome}
+	default:
+		return nil, fmt.Errorf("unknown rate source %q (want http, chrome or auto)", mode)
+	}
+	return &providerSource{provider: p, source: source}, nil
+}
+
+// parser returns the parser for the provider's rate as the page quotes it,
+// which is From per To when Inverse is set.
+func (p *Provider) parser() *RateParser {
+	from, to, _ := strings.Cut(p.Pair, "/")
+	if p.Inverse {
+		from, to = to, from
+	}
+	return &RateParser{Prefix: p.Prefix, Format: p.Format, From: from, To: to}
+}
+
+func (s *providerSource) Name() string {
+	return s.provider.Name
+}
+
+func (s *providerSource) Fetch(ctx context.Context) (Quote, error) {
+	q, err := s.source.Fetch(ctx)
+	if err != nil {
+		return Quote{}, fmt.Errorf("%s: %w", s.provider.Name, err)
+	}
+	if q.Rate <= 0 {
+		return Quote{}, fmt.Errorf("%s: rate %v is not positive", s.provider.Name, q.Rate)
+	}
+
+	per := s.provider.Per
+	if per == 0 {
+		per = 1
+	}
+	if s.provider.Inverse {
+		q.Rate = per / q.Rate
+	} else {
+		q.Rate /= per
+	}
+	q.Pair = s.provider.Pair
+	q.Provider = s.provider.Name
+	if s.provider.FeeField == "" {
+		q.Fees = s.provider.Fees
+	}
+	return q, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Quiet hours modes.
+const (
+	quietBatch    = "batch"    // hold alerts and send one summary afterwards
+	quietSuppress = "suppress" // drop alerts
+)
+
+// QuietHours is a daily window, e.g. 23:00-07:00 in Asia/Kuala_Lumpur, in
+// which alerts to Targets (all targets when empty) are not delivered unless
+// they come from an urgent rule. Without a Timezone the configured timezone
+// is used.
+type QuietHours struct {
+	Targets  []string `json:"targets,omitempty"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Timezone string   `json:"timezone,omitempty"`
+	Mode     string   `json:"mode,omitempty"` // batch (default) or suppress
+
+	location *time.Location
+}
+
+func (q *QuietHours) prepare() error {
+	if _, err := parseClock(q.Start); err != nil {
+		return fmt.Errorf("quiet hours: %v", err)
+	}
+	if _, err := parseClock(q.End); err != nil {
+		return fmt.Errorf("quiet hours: %v", err)
+	}
+	if q.Mode == "" {
+		q.Mode = quietBatch
+	}
+	if q.Mode != quietBatch && q.Mode != quietSuppress {
+		return fmt.Errorf("quiet hours: mode must be %q or %q", quietBatch, quietSuppress)
+	}
+
+	if q.Timezone != "" {
+		loc, err := time.LoadLocation(q.Timezone)
+		if err != nil {
+			return fmt.Errorf("quiet hours: invalid timezone: %v", err)
+		}
+		q.location = loc
+	}
+	return nil
+}
+
+// active reports whether now is inside the window.
+func (q *QuietHours) active(config *Config, now time.Time) bool {
+	loc := q.location
+	if loc == nil {
+		loc = config.location()
+	}
+	return inQuietHours(q.Start, q.End, now.In(loc))
+}
+
+func (q *QuietHours) appliesTo(target string) bool {
+	return len(q.Targets) == 0 || slices.Contains(q.Targets, target)
+}
+
+// quietHoursFor returns the quiet hours that apply to target, or nil: those
+// configured for target itself, else a subscriber's own (set with !quiet),
+// else those configured for all targets.
+func (c *Config) quietHoursFor(target string) *QuietHours {
+	var global *QuietHours
+	for _, q := range c.QuietHours {
+		if slices.Contains(q.Targets, target) {
+			return q
+		}
+		if global == nil && q.appliesTo(target) {
+			global = q
+		}
+	}
+	if q := c.subscriberQuietHours(target); q != nil {
+		return q
+	}
+	return global
+}
+
+// subscriberQuietHours returns the quiet hours a subscriber set for
+// themselves, in batch mode and the configured timezone, or nil.
+func (c *Config) subscriberQuietHours(target string) *QuietHours {
+	kind, address := splitTarget(target)
+	if c.Subscriptions == nil || kind != notifierWhatsApp {
+		return nil
+	}
+	start, end, err := c.Subscriptions.quietHours(address)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return nil
+	}
+	if start == "" || end == "" {
+		return nil
+	}
+	return &QuietHours{Targets: []string{target}, Start: start, End: end, Mode: quietBatch}
+}
+
+// quietHoursApply holds or drops a due notification whose target is in its
+// quiet hours, and reports whether it did.
+func quietHoursApply(config *Config, e outboxEntry, now time.Time) bool {
+	q := config.quietHoursFor(e.Target)
+	if q == nil || e.Notification.Urgent || !q.active(config, now) {
+		return false
+	}
+
+	kind, _ := splitTarget(e.Target)
+	if q.Mode == quietSuppress {
+		logger.Printf("Quiet hours: dropping notification to %s", e.Target)
+		notifications.Inc(kind, "suppressed")
+		if err := config.Outbox.Delivered(e.ID); err != nil {
+			logger.Printf("Error: %v", err)
+		}
+		return true
+	}
+
+	logger.Printf("Quiet hours: holding notification to %s until %s", e.Target, q.End)
+	notifications.Inc(kind, "held")
+	if err := config.Outbox.Hold(e, now); err != nil {
+		logger.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
+// releaseHeld queues one summary per target whose quiet hours have ended,
+// in place of the notifications held for it. A single held notification is
+// queued as it was.
+func releaseHeld(config *Config, now time.Time) {
+	held, err := config.Outbox.Held()
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return
+	}
+
+	for target, entries := range held {
+		if q := config.quietHoursFor(target); q != nil && q.active(config, now) {
+			continue
+		}
+
+		ids := make([]int64, len(entries))
+		for i, e := range entries {
+			ids[i] = e.ID
+		}
+		n := entries[0].Notification
+		if len(entries) > 1 {
+			n = heldSummary(config, entries, now)
+		}
+		if err := config.Outbox.Release(target, ids, n); err != nil {
+			logger.Printf("Error: %v", err)
+			continue
+		}
+		logger.Printf("Quiet hours over: releasing %d notification(s) to %s", len(entries), target)
+	}
+}
+
+func heldSummary(config *Config, entries []outboxEntry, now time.Time) Notification {
+	loc := config.location()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d alerts during quiet hours:", len(entries))
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "\n\n[%s] %s", e.Notification.Time.In(loc).Format("15:04"), e.Notification.Message)
+	}
+	last := entries[len(entries)-1].Notification
+	summary := Notification{Message: sb.String(), Pair: last.Pair, Rate: last.Rate, Time: now}
+	// Keep the chart of the latest alert that had one
+	for _, e := range entries {
+		if e.Notification.Chart != nil {
+			summary.Chart = e.Notification.Chart
+		}
+	}
+	return summary
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestQuietHoursForPrefersTarget(t *testing.T) {
+	global := &QuietHours{Start: "22:00", End: "07:00"}
+	own := &QuietHours{Targets: []string{"60123456789"}, Start: "23:00", End: "06:00", Mode: quietSuppress}
+	config := &Config{QuietHours: []*QuietHours{global, own}}
+
+	if q := config.quietHoursFor("60123456789"); q != own {
+		t.Errorf("quietHoursFor(target) = %+v, want the target's own window", q)
+	}
+	if q := config.quietHoursFor("60198765432"); q != global {
+		t.Errorf("quietHoursFor(other) = %+v, want the global window", q)
+	}
+}
+
+func TestSubscriberQuietHoursHoldAlerts(t *testing.T) {
+	config := newTestConfig(t)
+	subs, outbox := config.Subscriptions, config.Outbox
+	loc := time.FixedZone("UTC+8", 8*3600)
+	config.Location = loc
+
+	jid := "60123456789@s.whatsapp.net"
+	if err := subs.Upsert(jid, "SGD/MYR", 3.40, 3.55); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subs.SetQuietHours(jid, "22:00", "07:00"); err != nil {
+		t.Fatal(err)
+	}
+
+	pair, _ := lookupPair("SGD/MYR")
+	// 23:30 in the configured timezone, 15:30 UTC
+	at := time.Date(2026, 3, 1, 23, 30, 0, 0, loc)
+	notifySubscribers(context.Background(), config, pair, Quote{Pair: "SGD/MYR", Rate: 3.30, Timestamp: at})
+
+	due, err := outbox.Due(time.Now())
+	if err != nil || len(due) != 1 {
+		t.Fatalf("due = %v, %v; want the subscriber's alert queued", due, err)
+	}
+	if !quietHoursApply(config, due[0], at) {
+		t.Fatal("alert during the subscriber's quiet hours was not held")
+	}
+	recipient, _ := types.ParseJID(jid)
+	held, err := outbox.Held()
+	if err != nil || len(held[whatsAppTarget(recipient)]) != 1 {
+		t.Errorf("held = %v, %v; want one alert held for %s", held, err, jid)
+	}
+	if quietHoursApply(config, due[0], at.Add(8*time.Hour)) {
+		t.Error("alert after the subscriber's quiet hours was held")
+	}
+}
+
+func TestHeldSummaryKeepsChart(t *testing.T) {
+	chart := &ChartRequest{Pair: "SGD/MYR"}
+	entries := []outboxEntry{
+		{Notification: Notification{Message: "first", Pair: "SGD/MYR", Chart: chart}},
+		{Notification: Notification{Message: "second", Pair: "SGD/MYR"}},
+	}
+	if n := heldSummary(&Config{}, entries, time.Now()); n.Chart != chart {
+		t.Errorf("summary chart = %v, want the held alert's", n.Chart)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RateFormat says how a source writes its rate when the prefix alone does
+// not do: regular expressions tried before the built-in ones, and the
+// decimal separator.
+type RateFormat struct {
+	// Patterns must have a "rate" group and may have "unit" (the amount
+	// the rate is quoted for, e.g. 100 in "100 SGD = 345.21 MYR"), "from"
+	// and "to" groups for the currency codes.
+	Patterns []*regexp.Regexp
+	// Decimal is "." or ","; when empty it is worked out from each number
+	// where only one reading is possible, "." otherwise, and a number such
+	// as "3,455" that could be read either way is rejected.
+	Decimal string
+}
+
+// RateFormatFileConfig is how a rate format is written in the config file,
+// as part of a pair or a provider.
+type RateFormatFileConfig struct {
+	Patterns []string `json:"patterns,omitempty"`
+	Decimal  string   `json:"decimal,omitempty"`
+}
+
+func (fc RateFormatFileConfig) toRateFormat() (RateFormat, error) {
+	if fc.Decimal != "" && fc.Decimal != "." && fc.Decimal != "," {
+		return RateFormat{}, fmt.Errorf("decimal must be \".\" or \",\"")
+	}
+	format := RateFormat{Decimal: fc.Decimal}
+	for _, p := range fc.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return RateFormat{}, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+		if re.SubexpIndex("rate") < 0 {
+			return RateFormat{}, fmt.Errorf("pattern %q has no (?P<rate>...) group", p)
+		}
+		format.Patterns = append(format.Patterns, re)
+	}
+	return format, nil
+}
+
+// maxRateChange is how far, as a fraction, a fetched rate may be from the
+// last recorded one before it is taken for a misread rather than a move.
+const maxRateChange = 0.5
+
+// number matches a number with optional groups of three digits separated
+// by spaces, apostrophes, dots or commas, and a decimal part. It is
+// followed by a terminator so that it does not run into a time or another
+// number after it, as "12:00" in "3.4500 12:00".
+const (
+	number           = `\d{1,3}(?:[ ',.]\d{3})+(?:[.,]\d+)?|\d+(?:[.,]\d+)?`
+	numberTerminator = `(?:$|[^\d.,':]|[.,:](?:$|\D))`
+)
+
+var wholeNumber = regexp.MustCompile(`^(?:` + number + `)$`)
+
+type ratePattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// defaultRatePatterns are tried after the configured patterns and prefix,
+// so a change of wording or unit on the page does not stop the fetching.
+var defaultRatePatterns = []ratePattern{
+	{`"SGD 1.00 = MYR 3.45"`, regexp.MustCompile(
+		`(?i)\b(?P<from>[a-z]{3}) ?(?:(?P<unit>` + number + `) ?)?= ?(?P<to>[a-z]{3}) ?(?P<rate>` + number + `)` + numberTerminator)},
+	{`"1 SGD = 3.45 MYR"`, regexp.MustCompile(
+		`(?i)(?:^|[^\d.,'])(?:(?P<unit>` + number + `) ?)?(?P<from>[a-z]{3}) ?= ?(?P<rate>` + number + `) ?(?P<to>[a-z]{3})\b`)},
+	{"a bare number", regexp.MustCompile(`^(?P<rate>` + number + `)$`)},
+}
+
+// RateParser reads a rate from the text a source found on its page. From and
+// To, when set, are checked against the currency codes a pattern captures.
+type RateParser struct {
+	Prefix string
+	Format RateFormat
+	From   string
+	To     string
+}
+
+// PatternFailure is why one pattern could not read a rate.
+type PatternFailure struct {
+	Pattern string
+	Reason  string
+}
+
+// ParseError is returned when no pattern could read a rate from Text, with
+// what went wrong for each of them.
+type ParseError struct {
+	Text     string
+	Failures []PatternFailure
+}
+
+func (e *ParseError) Error() string {
+	reasons := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		reasons[i] = f.Pattern + ": " + f.Reason
+	}
+	return fmt.Sprintf("cannot read a rate from %q (%s)", e.Text, strings.Join(reasons, "; "))
+}
+
+// Parse returns the rate per one unit of From in text, trying the configured
+// patterns, then the prefix, then the built-in patterns.
+func (p *RateParser) Parse(text string) (float64, error) {
+	text = normalizeSpaces(text)
+	perr := &ParseError{Text: text}
+	fail := func(pattern string, err error) {
+		perr.Failures = append(perr.Failures, PatternFailure{Pattern: pattern, Reason: err.Error()})
+	}
+
+	for _, re := range p.Format.Patterns {
+		rate, err := p.match(re, text)
+		if err == nil {
+			return rate, nil
+		}
+		fail("pattern "+re.String(), err)
+	}
+
+	if prefix := normalizeSpaces(p.Prefix); prefix != "" {
+		rest, ok := strings.CutPrefix(text, prefix)
+		if !ok {
+			fail(fmt.Sprintf("prefix %q", prefix), errors.New("text does not start with it"))
+		} else if rate, err := p.number(strings.TrimSpace(rest), "rate"); err != nil {
+			fail(fmt.Sprintf("prefix %q", prefix), err)
+		} else {
+			return rate, nil
+		}
+	}
+
+	for _, pattern := range defaultRatePatterns {
+		rate, err := p.match(pattern.re, text)
+		if err == nil {
+			return rate, nil
+		}
+		fail(pattern.name, err)
+	}
+	return 0, perr
+}
+
+// match reads the rate from the groups of re in text, dividing by the unit
+// and checking the currency codes when re has them.
+func (p *RateParser) match(re *regexp.Regexp, text string) (float64, error) {
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return 0, errors.New("no match")
+	}
+	group := func(name string) string {
+		if i := re.SubexpIndex(name); i >= 0 {
+			return strings.TrimSpace(m[i])
+		}
+		return ""
+	}
+
+	for _, code := range []struct{ name, got, want string }{
+		{"from", group("from"), p.From},
+		{"to", group("to"), p.To},
+	} {
+		if code.got != "" && code.want != "" && !strings.EqualFold(code.got, code.want) {
+			return 0, fmt.Errorf("quotes %s as the %s currency, expected %s", strings.ToUpper(code.got), code.name, code.want)
+		}
+	}
+
+	rate, err := p.number(group("rate"), "rate")
+	if err != nil {
+		return 0, err
+	}
+	if unit := group("unit"); unit != "" {
+		per, err := p.number(unit, "unit")
+		if err != nil {
+			return 0, err
+		}
+		rate /= per
+	}
+	return rate, nil
+}
+
+// number parses a positive number written with the format's separators.
+func (p *RateParser) number(s, what string) (float64, error) {
+	v, err := parseNumber(s, p.Format.Decimal)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q %v", what, s, err)
+	}
+	if v <= 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("%s %q is not positive", what, s)
+	}
+	return v, nil
+}
+
+// parseNumber parses s with decimal as the decimal separator and the other
+// of "." and "," (as well as spaces and apostrophes) as the thousands
+// separator, e.g. "1.234,5" with ",". With decimal empty it is the last of
+// two different separators, the one of a repeated separator's other, a
+// lone comma not followed by three digits, or else ".".
+func parseNumber(s, decimal string) (float64, error) {
+	if !wholeNumber.MatchString(s) {
+		return 0, errors.New("is not a number")
+	}
+	s = strings.NewReplacer(" ", "", "'", "").Replace(s)
+	if decimal == "" {
+		dots, commas := strings.Count(s, "."), strings.Count(s, ",")
+		switch {
+		case dots > 0 && commas > 0:
+			decimal = "."
+			if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+				decimal = ","
+			}
+		case dots > 1:
+			decimal = ","
+		case commas > 1:
+			decimal = "."
+		case commas == 1 && len(s)-strings.Index(s, ",")-1 == 3:
+			return 0, errors.New(`could be read either way: set decimal to "." or ","`)
+		case commas == 1:
+			decimal = ","
+		default:
+			decimal = "."
+		}
+	}
+	thousands := ","
+	if decimal == "," {
+		thousands = "."
+	}
+	s = strings.ReplaceAll(s, thousands, "")
+	if strings.Count(s, decimal) > 1 {
+		return 0, errors.New("is not a number")
+	}
+	return strconv.ParseFloat(strings.Replace(s, decimal, ".", 1), 64)
+}
+
+// checkRateChange returns an error when rate is more than maxRateChange away
+// from last, the last recorded rate (zero when there is none), as a rate
+// read from the wrong number or with the wrong separator would be.
+func checkRateChange(rate, last float64) error {
+	if last > 0 && math.Abs(rate-last)/last > maxRateChange {
+		return fmt.Errorf("rate %v is implausibly far from the last rate %v", rate, last)
+	}
+	return nil
+}
+
+// normalizeSpaces turns the non-breaking and thin spaces pages use into
+// plain ones and collapses runs of spaces.
+func normalizeSpaces(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '\u00a0', '\u2007', '\u2009', '\u202f':
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
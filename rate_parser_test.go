@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestRateParserParse(t *testing.T) {
+	parser := &RateParser{Prefix: "SGD 1.00 = MYR ", From: "SGD", To: "MYR"}
+	tests := []struct {
+		text string
+		want float64
+	}{
+		{"SGD 1.00 = MYR 3.4521", 3.4521},
+		{"SGD 1.00 = MYR 3.4521", 3.4521},
+		{"SGD 100 = MYR 345.21", 3.4521},
+		{"100 SGD = 345.21 MYR", 3.4521},
+		{"1 000 SGD = 3 452.10 MYR", 3.4521},
+		{"Rate: 1 SGD = 3,4521 MYR", 3.4521},
+		{"SGD 1.00 = MYR 3.4500 12:00", 3.45},
+		{"SGD 1.00 = MYR 3.45 (indicative)", 3.45},
+		{"SGD 1.00 = MYR 3.45.", 3.45},
+		{"3.4521", 3.4521},
+		{" 3.4521 ", 3.4521},
+	}
+	for _, tt := range tests {
+		got, err := parser.Parse(tt.text)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.text, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Parse(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRateParserParseErrors(t *testing.T) {
+	parser := &RateParser{Prefix: "SGD 1.00 = MYR ", From: "SGD", To: "MYR"}
+	for _, text := range []string{
+		"",
+		"SGD 1.00 = MYR abc",
+		"SGD 1.00 = MYR 0",
+		"SGD 1 = MYR 3,455",
+		"SGD 1.00 = IDR 11,800.50",
+		"3.45 4.56",
+	} {
+		rate, err := parser.Parse(text)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Parse(%q) = %v, %v; want a ParseError", text, rate, err)
+			continue
+		}
+		if len(perr.Failures) == 0 {
+			t.Errorf("Parse(%q): ParseError without failures", text)
+		}
+	}
+}
+
+func TestRateParserPatterns(t *testing.T) {
+	format, err := RateFormatFileConfig{
+		Patterns: []string{`Buy (?P<unit>\d+) (?P<from>[A-Z]{3}) for (?P<rate>[\d.,]+)`},
+		Decimal:  ",",
+	}.toRateFormat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := &RateParser{Format: format, From: "SGD", To: "MYR"}
+	if got, err := parser.Parse("Buy 1000 SGD for 3.452,10"); err != nil || math.Abs(got-3.4521) > 1e-9 {
+		t.Errorf("Parse = %v, %v; want 3.4521", got, err)
+	}
+	if got, err := parser.Parse("Buy 1 SGD for 3,455"); err != nil || got != 3.455 {
+		t.Errorf("Parse with decimal \",\" = %v, %v; want 3.455", got, err)
+	}
+
+	for _, fc := range []RateFormatFileConfig{
+		{Patterns: []string{`(\d+)`}},
+		{Patterns: []string{`(?P<rate>`}},
+		{Decimal: "x"},
+	} {
+		if _, err := fc.toRateFormat(); err == nil {
+			t.Errorf("toRateFormat(%+v) succeeded, want an error", fc)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		s       string
+		decimal string
+		want    float64
+		wantErr bool
+	}{
+		{"3.4521", "", 3.4521, false},
+		{"1,234.56", "", 1234.56, false},
+		{"1.234,56", "", 1234.56, false},
+		{"1 234,56", "", 1234.56, false},
+		{"1'234.5", "", 1234.5, false},
+		{"1,234,567", "", 1234567, false},
+		{"1.234.567", "", 1234567, false},
+		{"3,45", "", 3.45, false},
+		{"3.450", "", 3.45, false},
+		{"3,455", "", 0, true},
+		{"3,455", ",", 3.455, false},
+		{"3,455", ".", 3455, false},
+		{"3.4500 12", "", 0, true},
+		{"3 4521", "", 0, true},
+		{"1,234.567,8", "", 0, true},
+		{"", "", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseNumber(tt.s, tt.decimal)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseNumber(%q, %q) = %v, want an error", tt.s, tt.decimal, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseNumber(%q, %q) = %v, %v; want %v", tt.s, tt.decimal, got, err, tt.want)
+		}
+	}
+}
+
+func TestCheckRateChange(t *testing.T) {
+	tests := []struct {
+		rate, last float64
+		wantErr    bool
+	}{
+		{3.45, 0, false},
+		{3.45, 3.40, false},
+		{3455, 3.45, true},
+		{0.0345, 3.45, true},
+		{1.5, 3.45, true},
+	}
+	for _, tt := range tests {
+		if err := checkRateChange(tt.rate, tt.last); (err != nil) != tt.wantErr {
+			t.Errorf("checkRateChange(%v, %v) = %v, want error %v", tt.rate, tt.last, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Quote is a single exchange rate observation returned by a RateSource.
+type Quote struct {
+	Pair      string
+	Rate      float64
+	Timestamp time.Time
+	Source    string
+	Latency   time.Duration
+
+	// Provider is who quoted the rate, "CIMB" for the monitored pairs, and
+	// Fees what they charge on a transfer.
+	Provider string
+	Fees     FeeModel
+}
+
+// RateSource fetches the current exchange rate from somewhere (a web page,
+// an API, a fake in tests) and returns it as a Quote.
+type RateSource interface {
+	Name() string
+	Fetch(ctx context.Context) (Quote, error)
+}
+
+// resettableSource is implemented by sources that hold a long-lived resource,
+// such as a browser, which should be recreated after repeated failures.
+type resettableSource interface {
+	Reset()
+}
+
+func resetSource(source RateSource) {
+	if r, ok := source.(resettableSource); ok {
+		r.Reset()
+	}
+}
+
+// fallbackRateSource tries the primary source first and only falls back to
+// the secondary one when the primary fails.
+type fallbackRateSource struct {
+	primary  RateSource
+	fallback RateSource
+}
+
+func (s *fallbackRateSource) Name() string {
+	return s.primary.Name() + "+" + s.fallback.Name()
+}
+
+func (s *fallbackRateSource) Fetch(ctx context.Context) (Quote, error) {
+	quote, err := s.primary.Fetch(ctx)
+	if err == nil {
+		return quote, nil
+	}
+	logger.Printf("%s source failed: %v. Falling back to %s.", s.primary.Name(), err, s.fallback.Name())
+	return s.fallback.Fetch(ctx)
+}
+
+func (s *fallbackRateSource) Reset() {
+	resetSource(s.primary)
+	resetSource(s.fallback)
+}
+
+// newRateSource builds the rate source selected at startup for a pair:
+//   - "http":   plain HTTP only
+//   - "chrome": headless Chrome only
+//   - "auto":   plain HTTP, falling back to headless Chrome when it fails
+//
+// Plain HTTP reads the pair's JSON endpoint when it has one, or else its
+// page, unless the page is scripted; Chrome needs a page and a selector.
+func newRateSource(mode string, pair *CurrencyPair, browser *chromeBrowser) (RateSource, error) {
+	var page, chrome RateSource
+	switch {
+	case pair.JSONURL != "":
+		source := NewHTTPRateSource(pair.JSONURL, "", pair.parser())
+		source.JSONField = pair.JSONField
+		page = source
+	case !pair.Scripted:
+		page = NewHTTPRateSource(pair.URL, pair.Selector, pair.parser())
+	}
+	if pair.URL != "" && pair.Selector != "" {
+		chrome = NewChromeRateSource(browser, pair.URL, pair.Selector, pair.parser())
+	}
+
+	switch mode {
+	case "http":
+		if page == nil {
+			return nil, fmt.Errorf("%s: the page fills its rate in with JavaScript, so it cannot be read over plain HTTP; set json_url and json_field, or use -source=chrome or auto", pair.Name())
+		}
+		return page, nil
+	case "chrome":
+		if chrome == nil {
+			return nil, fmt.Errorf("%s: no page to read in Chrome; set url and selector", pair.Name())
+		}
+		return chrome, nil
+	case "auto", "":
+		switch {
+		case page == nil:
+			return chrome, nil
+		case chrome == nil:
+			return page, nil
+		}
+		return &fallbackRateSource{primary: page, fallback: chrome}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate source %q (want http, chrome or auto)", mode)
+	}
+}
+
+// monitoredPair ties a configured pair to its rate source, its alert rules
+// and the last rate seen for it.
+type monitoredPair struct {
+	pair     *CurrencyPair
+	source   RateSource
+	rules    []*AlertRule
+	prevRate float64
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeRateSource returns its rates in turn, repeating the last one; a zero
+// rate is a failed fetch.
+type fakeRateSource struct {
+	rates []float64
+	calls int
+}
+
+func (s *fakeRateSource) Name() string {
+	return "fake"
+}
+
+func (s *fakeRateSource) Fetch(ctx context.Context) (Quote, error) {
+	rate := s.rates[min(s.calls, len(s.rates)-1)]
+	s.calls++
+	if rate == 0 {
+		return Quote{}, errors.New("fetch failed")
+	}
+	return Quote{Rate: rate, Timestamp: time.Now(), Source: s.Name()}, nil
+}
+
+// newTestConfig returns a Config whose stores are backed by a database in a
+// temporary directory.
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+	db, err := openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	config := &Config{}
+	if config.History, err = NewRateHistory(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	if config.AlertState, err = NewAlertStateStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if config.Subscriptions, err = NewSubscriptionStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if config.Outbox, err = NewOutbox(db); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func newTestMonitor(t *testing.T, rates ...float64) (*monitoredPair, *Config, *fakeRateSource) {
+	t.Helper()
+	pair, _ := lookupPair("SGD/MYR")
+	source := &fakeRateSource{rates: rates}
+	return &monitoredPair{pair: pair, source: source}, newTestConfig(t), source
+}
+
+func TestFetchAndPrintLabel(t *testing.T) {
+	m, config, _ := newTestMonitor(t, 3.45, 3.46)
+	ctx := context.Background()
+
+	for _, want := range []float64{3.45, 3.46} {
+		if err := fetchAndPrintLabel(ctx, m, config); err != nil {
+			t.Fatal(err)
+		}
+		if m.prevRate != want {
+			t.Errorf("prevRate = %v, want %v", m.prevRate, want)
+		}
+		last, ok, err := config.History.Latest("SGD/MYR")
+		if err != nil || !ok || last.Rate != want || last.Source != "fake" {
+			t.Errorf("latest recorded quote = %+v, %v, %v; want %v from fake", last, ok, err, want)
+		}
+	}
+	if quotes := config.latestQuotes(); len(quotes) != 1 || quotes[0].Provider != cimbProvider {
+		t.Errorf("latest quotes = %+v, want one CIMB quote", quotes)
+	}
+}
+
+func TestFetchAndPrintLabelRejectsImplausibleRate(t *testing.T) {
+	m, config, _ := newTestMonitor(t, 3.45, 3455)
+	ctx := context.Background()
+	if err := fetchAndPrintLabel(ctx, m, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchAndPrintLabel(ctx, m, config); err == nil {
+		t.Error("a rate 1000 times the last one was accepted")
+	}
+	if last, _, _ := config.History.Latest("SGD/MYR"); m.prevRate != 3.45 || last.Rate != 3.45 {
+		t.Errorf("prevRate %v, latest recorded %v after a rejected rate; want 3.45", m.prevRate, last.Rate)
+	}
+}
+
+func TestFetchAndPrintLabelWithRetry(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+	ctx := context.Background()
+
+	m, config, source := newTestMonitor(t, 0, 0, 3.45)
+	if err := fetchAndPrintLabelWithRetry(ctx, m, config); err != nil {
+		t.Errorf("third attempt failed: %v", err)
+	}
+	if source.calls != 3 || m.prevRate != 3.45 {
+		t.Errorf("calls %d, prevRate %v; want 3 and 3.45", source.calls, m.prevRate)
+	}
+
+	m, config, source = newTestMonitor(t, 0)
+	if err := fetchAndPrintLabelWithRetry(ctx, m, config); err == nil {
+		t.Error("no error after every attempt failed")
+	}
+	if _, ok, _ := config.History.Latest("SGD/MYR"); source.calls != 3 || ok {
+		t.Errorf("calls %d, recorded %v; want 3 and nothing recorded", source.calls, ok)
+	}
+}
+
+func TestNewRateSourceForScriptedPages(t *testing.T) {
+	pair, _ := lookupPair("SGD/MYR")
+	if _, err := newRateSource("http", pair, nil); err == nil {
+		t.Error("http source for a scripted page succeeded, want an error")
+	}
+	source, err := newRateSource("auto", pair, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := source.(*ChromeRateSource); !ok {
+		t.Errorf("auto source for a scripted page is %T, want *ChromeRateSource", source)
+	}
+
+	pair.JSONURL, pair.JSONField = "https://example.com/rates", "data.rate"
+	source, err = newRateSource("auto", pair, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback, ok := source.(*fallbackRateSource)
+	if !ok {
+		t.Fatalf("auto source with a json_url is %T, want *fallbackRateSource", source)
+	}
+	if page, ok := fallback.primary.(*HTTPRateSource); !ok || page.URL != pair.JSONURL || page.JSONField != "data.rate" {
+		t.Errorf("primary source is %+v, want the JSON endpoint", fallback.primary)
+	}
+}
+
+func TestHTTPRateSourceJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": {"rate": "SGD 1.00 = MYR 3.4521"}}`)
+	}))
+	defer srv.Close()
+
+	pc := PairFileConfig{Pair: "SGD/MYR", JSONURL: srv.URL, JSONField: "data.rate"}
+	pair, err := pc.toPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := newRateSource("http", pair, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote, err := source.Fetch(context.Background())
+	if err != nil || quote.Rate != 3.4521 {
+		t.Errorf("Fetch = %v, %v; want 3.4521", quote.Rate, err)
+	}
+
+	if _, err := (PairFileConfig{Pair: "SGD/MYR", JSONURL: srv.URL}).toPair(); err == nil {
+		t.Error("json_url without json_field accepted")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Thresholds is the alert range of one pair. FixedRules names the pair's
+// threshold rules with their own min and max, which the range does not
+// affect.
+type Thresholds struct {
+	Pair       string   `json:"pair"`
+	Min        float64  `json:"min"`
+	Max        float64  `json:"max"`
+	FixedRules []string `json:"fixed_rules,omitempty"`
+}
+
+// recordLatest remembers q as the latest quote for its pair.
+func (c *Config) recordLatest(q Quote) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.latest == nil {
+		c.latest = make(map[string]Quote)
+	}
+	c.latest[q.Pair] = q
+	c.lastFetch = q.Timestamp
+}
+
+// latestQuotes returns the latest quote of every pair fetched so far, sorted
+// by pair name.
+func (c *Config) latestQuotes() []Quote {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	quotes := make([]Quote, 0, len(c.latest))
+	for _, q := range c.latest {
+		quotes = append(quotes, q)
+	}
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Pair < quotes[j].Pair })
+	return quotes
+}
+
+// recordComparison remembers the latest quotes of pair from every provider,
+// best first.
+func (c *Config) recordComparison(pair string, quotes []Quote) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.comparisons == nil {
+		c.comparisons = make(map[string][]Quote)
+	}
+	c.comparisons[pair] = quotes
+}
+
+// providerCount returns how many providers are configured for pair.
+func (c *Config) providerCount(pair string) int {
+	n := 0
+	for _, p := range c.Providers {
+		if pairKey(p.Pair) == pairKey(pair) {
+			n++
+		}
+	}
+	return n
+}
+
+// comparison returns the latest quotes of pair from every provider, best
+// first, or nil before providers have been compared.
+func (c *Config) comparison(pair string) []Quote {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.comparisons[pair]
+}
+
+// lastFetchTime returns when a rate was last fetched successfully.
+func (c *Config) lastFetchTime() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastFetch
+}
+
+func (c *Config) thresholds() []Thresholds {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var list []Thresholds
+	for _, pair := range c.Pairs {
+		list = append(list, Thresholds{
+			Pair:       pair.Name(),
+			Min:        pair.DesiredMinRate,
+			Max:        pair.DesiredMaxRate,
+			FixedRules: c.fixedRules(pair.Name()),
+		})
+	}
+	return list
+}
+
+// fixedRules returns the names of pair's threshold rules that have their
+// own min and max rather than following the pair's range.
+func (c *Config) fixedRules(pair string) []string {
+	var names []string
+	for _, rule := range c.Rules {
+		if rule.Type == ruleThreshold && (rule.Min != 0 || rule.Max != 0) && pairKey(rule.Pair) == pairKey(pair) {
+			names = append(names, rule.Name)
+		}
+	}
+	return names
+}
+
+// setThresholds updates the alert ranges of monitored pairs. Either every
+// update is valid and applied or none is. The new ranges apply from the next
+// fetch.
+func (c *Config) setThresholds(updates ...Thresholds) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pairs := make([]*CurrencyPair, len(updates))
+	for i, t := range updates {
+		if t.Max <= t.Min {
+			return fmt.Errorf("%s: maximum rate (%.4f) must be greater than minimum rate (%.4f)", t.Pair, t.Max, t.Min)
+		}
+		if pairs[i] = findPair(c.Pairs, t.Pair); pairs[i] == nil {
+			return fmt.Errorf("pair %s is not being monitored", t.Pair)
+		}
+	}
+	for i, t := range updates {
+		pairs[i].DesiredMinRate = t.Min
+		pairs[i].DesiredMaxRate = t.Max
+		logger.Printf("Thresholds for %s changed to %.4f - %.4f", pairs[i].Name(), t.Min, t.Max)
+	}
+	return nil
+}
+
+// pauseAlerts suppresses alerts until the given time; the zero time resumes
+// them. It returns the new pause end.
+func (c *Config) pauseAlerts(until time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pausedUntil = until
+	if until.IsZero() {
+		logger.Println("Alerts resumed")
+	} else {
+		logger.Printf("Alerts paused until %s", until.Format("2006-01-02 15:04:05"))
+	}
+	return until
+}
+
+func (c *Config) alertsPausedUntil() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pausedUntil
+}
+
+// location returns the timezone for alert messages, the local one unless
+// configured.
+func (c *Config) location() *time.Location {
+	if c.Location == nil {
+		return time.Local
+	}
+	return c.Location
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Subscription is one person's own alert band for a pair. Subscribers manage
+// their subscriptions by direct message (see runSubscriptionCommand) and are
+// alerted independently of the configured rules and NotifyTargets.
+type Subscription struct {
+	JID        string // subscriber's WhatsApp JID, e.g. 60123456789@s.whatsapp.net
+	Pair       string
+	Min        float64
+	Max        float64
+	QuietStart string // HH:MM in the configured timezone, empty if unset
+	QuietEnd   string
+	Enabled    bool
+	// Armed is true when the subscription may alert. It is cleared when an
+	// alert is sent and set again once the rate is back inside the band.
+	Armed bool
+}
+
+// SubscriptionStore persists subscriptions in the subscriptions table, in the
+// same database as the WhatsApp session.
+type SubscriptionStore struct {
+	db *sql.DB
+}
+
+func NewSubscriptionStore(db *sql.DB) (*SubscriptionStore, error) {
+	err := execSchema(db,
+		`CREATE TABLE IF NOT EXISTS subscriptions (
+			jid         TEXT    NOT NULL,
+			pair        TEXT    NOT NULL,
+			min         REAL    NOT NULL,
+			max         REAL    NOT NULL,
+			quiet_start TEXT    NOT NULL DEFAULT '',
+			quiet_end   TEXT    NOT NULL DEFAULT '',
+			enabled     INTEGER NOT NULL DEFAULT 1,
+			armed       INTEGER NOT NULL DEFAULT 1,
+			PRIMARY KEY (jid, pair)
+		)`,
+		`CREATE INDEX IF NOT EXISTS subscriptions_pair ON subscriptions (pair)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &SubscriptionStore{db: db}, nil
+}
+
+// Upsert creates or replaces the band of a subscription, enabling and arming
+// it. Quiet hours already set for the subscriber are kept.
+func (s *SubscriptionStore) Upsert(jid, pair string, min, max float64) error {
+	start, end, err := s.quietHours(jid)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO subscriptions (jid, pair, min, max, quiet_start, quiet_end, enabled, armed) VALUES (?, ?, ?, ?, ?, ?, 1, 1)
+		 ON CONFLICT (jid, pair) DO UPDATE SET min = excluded.min, max = excluded.max, enabled = 1, armed = 1`,
+		jid, pair, min, max, start, end,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save subscription: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the subscriber's subscription to pair, or all of them when
+// pair is empty. It returns how many were removed.
+func (s *SubscriptionStore) Delete(jid, pair string) (int64, error) {
+	query, args := `DELETE FROM subscriptions WHERE jid = ?`, []interface{}{jid}
+	if pair != "" {
+		query, args = query+` AND pair = ?`, append(args, pair)
+	}
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete subscription: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+// ForJID returns every subscription of one subscriber, ordered by pair.
+func (s *SubscriptionStore) ForJID(jid string) ([]Subscription, error) {
+	return s.query(`WHERE jid = ? ORDER BY pair`, jid)
+}
+
+// ForPair returns the enabled subscriptions to pair.
+func (s *SubscriptionStore) ForPair(pair string) ([]Subscription, error) {
+	return s.query(`WHERE pair = ? AND enabled = 1 ORDER BY jid`, pair)
+}
+
+// SetEnabled enables or disables the subscriber's subscription to pair, or
+// all of them when pair is empty. It returns how many were changed.
+func (s *SubscriptionStore) SetEnabled(jid, pair string, enabled bool) (int64, error) {
+	query, args := `UPDATE subscriptions SET enabled = ?, armed = 1 WHERE jid = ?`, []interface{}{enabled, jid}
+	if pair != "" {
+		query, args = query+` AND pair = ?`, append(args, pair)
+	}
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update subscription: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+// SetQuietHours sets the quiet hours of all of the subscriber's
+// subscriptions. Empty start and end clear them.
+func (s *SubscriptionStore) SetQuietHours(jid, start, end string) (int64, error) {
+	res, err := s.db.Exec(`UPDATE subscriptions SET quiet_start = ?, quiet_end = ? WHERE jid = ?`, start, end, jid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update quiet hours: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *SubscriptionStore) SetArmed(jid, pair string, armed bool) error {
+	_, err := s.db.Exec(`UPDATE subscriptions SET armed = ? WHERE jid = ? AND pair = ?`, armed, jid, pair)
+	if err != nil {
+		return fmt.Errorf("failed to update subscription: %v", err)
+	}
+	return nil
+}
+
+func (s *SubscriptionStore) quietHours(jid string) (start, end string, err error) {
+	err = s.db.QueryRow(
+		`SELECT quiet_start, quiet_end FROM subscriptions WHERE jid = ? LIMIT 1`, jid,
+	).Scan(&start, &end)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read subscription: %v", err)
+	}
+	return start, end, nil
+}
+
+func (s *SubscriptionStore) query(where string, args ...interface{}) ([]Subscription, error) {
+	rows, err := s.db.Query(
+		`SELECT jid, pair, min, max, quiet_start, quiet_end, enabled, armed FROM subscriptions `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		var sub Subscription
+		if err := rows.Scan(&sub.JID, &sub.Pair, &sub.Min, &sub.Max,
+			&sub.QuietStart, &sub.QuietEnd, &sub.Enabled, &sub.Armed); err != nil {
+			return nil, fmt.Errorf("failed to read subscriptions: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions: %v", err)
+	}
+	return subs, nil
+}
+
+// inQuietHours reports whether now falls between start and end (HH:MM, local
+// time). A range whose end is before its start runs past midnight, e.g.
+// 22:00-07:00.
+func inQuietHours(start, end string, now time.Time) bool {
+	if start == "" || end == "" {
+		return false
+	}
+	from, err1 := parseClock(start)
+	to, err2 := parseClock(end)
+	if err1 != nil || err2 != nil || from == to {
+		return false
+	}
+	t := now.Hour()*60 + now.Minute()
+	if from < to {
+		return t >= from && t < to
+	}
+	return t >= from || t < to
+}
+
+// parseClock parses HH:MM into minutes after midnight.
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, err1 := strconv.Atoi(hh)
+	m, err2 := strconv.Atoi(mm)
+	if !ok || err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// notifySubscribers alerts every subscriber to pair whose band the rate is
+// at the limits of or outside of. Like a threshold rule, a subscription
+// alerts once and re-arms when the rate is back inside the band. Alerts
+// during the subscriber's quiet hours are held and sent as one summary
+// afterwards, as for any target.
+func notifySubscribers(ctx context.Context, config *Config, pair *CurrencyPair, quote Quote) {
+	if config.Subscriptions == nil || config.alertsPausedUntil().After(quote.Timestamp) {
+		return
+	}
+	subs, err := config.Subscriptions.ForPair(pair.Name())
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		return
+	}
+
+	for _, sub := range subs {
+		// At a limit counts as outside, as for threshold rules
+		outside := quote.Rate <= sub.Min || quote.Rate >= sub.Max
+		if !outside {
+			if !sub.Armed {
+				if err := config.Subscriptions.SetArmed(sub.JID, sub.Pair, true); err != nil {
+					logger.Printf("Error: %v", err)
+				}
+			}
+			continue
+		}
+		if !sub.Armed {
+			continue
+		}
+
+		recipient, err := types.ParseJID(sub.JID)
+		if err != nil {
+			logger.Printf("Error: invalid subscriber %s: %v", sub.JID, err)
+			continue
+		}
+		if err := config.Subscriptions.SetArmed(sub.JID, sub.Pair, false); err != nil {
+			logger.Printf("Error: %v", err)
+			continue
+		}
+		message := fmt.Sprintf("Alert: The current rate is %s 1.00 = %s %.4f (your range %.4f - %.4f)",
+			pair.From, pair.To, quote.Rate, sub.Min, sub.Max)
+		logger.Printf("Subscription %s %s fired: %s", recipient.User, sub.Pair, message)
+		notify(config, whatsAppTarget(recipient), Notification{
+			Message: message, Pair: pair.Name(), Rate: quote.Rate, Time: quote.Timestamp,
+		})
+	}
+}
+
+const subscriptionHelp = `Subscription commands (direct message only):
+!subscribe <pair> <min> <max> - alert me when the rate leaves min-max
+!unsubscribe [pair] - stop one or all subscriptions
+!subscriptions - list my subscriptions
+!quiet HH:MM-HH:MM|off - no alerts during these hours
+!enable [pair] / !disable [pair] - turn alerts on or off`
+
+func isSubscriptionCommand(cmd string) bool {
+	switch strings.ToLower(cmd) {
+	case "!subscribe", "!unsubscribe", "!subscriptions", "!quiet", "!enable", "!disable":
+		return true
+	}
+	return false
+}
+
+// runSubscriptionCommand executes a subscription command for the subscriber
+// jid and returns the reply text.
+func runSubscriptionCommand(config *Config, jid string, args []string) string {
+	store := config.Subscriptions
+	if store == nil {
+		return "Subscriptions are not available"
+	}
+
+	// Every command but !subscribe and !quiet takes an optional pair.
+	var pair string
+	if len(args) > 1 && strings.ToLower(args[0]) != "!quiet" {
+		t, err := config.botPairThresholds(args[1:2])
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		pair = t.Pair
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "!subscribe":
+		if len(args) < 4 {
+			return "Usage: !subscribe <pair> <min> <max>, e.g. !subscribe SGD/MYR 3.40 3.55"
+		}
+		min, err1 := strconv.ParseFloat(args[2], 64)
+		max, err2 := strconv.ParseFloat(args[3], 64)
+		if err1 != nil || err2 != nil {
+			return "Invalid rate"
+		}
+		if max <= min {
+			return "Error: maximum rate must be greater than minimum rate"
+		}
+		if err := store.Upsert(jid, pair, min, max); err != nil {
+			logger.Printf("Error: %v", err)
+			return "Failed to save subscription"
+		}
+		return fmt.Sprintf("Subscribed to %s: alert below %.4f or above %.4f", pair, min, max)
+	case "!unsubscribe":
+		n, err := store.Delete(jid, pair)
+		if err != nil {
+			logger.Printf("Error: %v", err)
+			return "Failed to remove subscription"
+		}
+		if n == 0 {
+			return "No matching subscription"
+		}
+		return fmt.Sprintf("Removed %d subscription(s)", n)
+	case "!subscriptions":
+		subs, err := store.ForJID(jid)
+		if err != nil {
+			logger.Printf("Error: %v", err)
+			return "Failed to read subscriptions"
+		}
+		if len(subs) == 0 {
+			return "No subscriptions.\n" + subscriptionHelp
+		}
+		var sb strings.Builder
+		for _, sub := range subs {
+			fmt.Fprintf(&sb, "%s: min %.4f, max %.4f", sub.Pair, sub.Min, sub.Max)
+			if !sub.Enabled {
+				sb.WriteString(" (disabled)")
+			}
+			sb.WriteString("\n")
+		}
+		if subs[0].QuietStart != "" {
+			fmt.Fprintf(&sb, "Quiet hours: %s-%s\n", subs[0].QuietStart, subs[0].QuietEnd)
+		}
+		return strings.TrimSpace(sb.String())
+	case "!quiet":
+		if len(args) < 2 {
+			return "Usage: !quiet HH:MM-HH:MM|off, e.g. !quiet 22:00-07:00"
+		}
+		var start, end string
+		if strings.ToLower(args[1]) != "off" {
+			var ok bool
+			start, end, ok = strings.Cut(args[1], "-")
+			if _, err := parseClock(start); !ok || err != nil {
+				return fmt.Sprintf("Invalid quiet hours %q", args[1])
+			}
+			if _, err := parseClock(end); err != nil {
+				return fmt.Sprintf("Invalid quiet hours %q", args[1])
+			}
+		}
+		n, err := store.SetQuietHours(jid, start, end)
+		if err != nil {
+			logger.Printf("Error: %v", err)
+			return "Failed to save quiet hours"
+		}
+		if n == 0 {
+			return "No subscriptions yet. Use !subscribe first"
+		}
+		if start == "" {
+			return "Quiet hours off"
+		}
+		return fmt.Sprintf("Quiet hours set to %s-%s", start, end)
+	case "!enable", "!disable":
+		enabled := strings.ToLower(args[0]) == "!enable"
+		n, err := store.SetEnabled(jid, pair, enabled)
+		if err != nil {
+			logger.Printf("Error: %v", err)
+			return "Failed to update subscription"
+		}
+		if n == 0 {
+			return "No matching subscription"
+		}
+		if enabled {
+			return fmt.Sprintf("Enabled %d subscription(s)", n)
+		}
+		return fmt.Sprintf("Disabled %d subscription(s)", n)
+	default:
+		return subscriptionHelp
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNotifySubscribersAtLimit(t *testing.T) {
+	config := newTestConfig(t)
+	subs, outbox := config.Subscriptions, config.Outbox
+	pair, _ := lookupPair("SGD/MYR")
+	jid := "60123456789@s.whatsapp.net"
+
+	for _, rate := range []float64{3.40, 3.55} {
+		if err := subs.Upsert(jid, "SGD/MYR", 3.40, 3.55); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := outbox.Due(time.Now())
+		notifySubscribers(context.Background(), config, pair, Quote{Pair: "SGD/MYR", Rate: rate, Timestamp: time.Now()})
+		after, _ := outbox.Due(time.Now())
+		if len(after) != len(before)+1 {
+			t.Errorf("rate %v at the limit of 3.40 - 3.55 queued %d alerts, want 1", rate, len(after)-len(before))
+		}
+	}
+}
@@ -10,10 +10,10 @@ import (
 func getBriefDescription() string {
 	return `
 **Program Overview:**
-This program monitors the SGD to MYR exchange rate from the CIMB Clicks website. It provides real-time updates and sends notifications via WhatsApp based on user-defined criteria.
+This program monitors exchange rates such as SGD to MYR from the CIMB Clicks website. It provides real-time updates and sends notifications via WhatsApp based on user-defined criteria.
 
 **Key Features:**
-- Monitors exchange rate from CIMB Clicks website.
+- Monitors one or more currency pairs from CIMB Clicks website.
 - Provides color-coded updates:
   - Green: Rate increased
   - Red: Rate decreased
@@ -21,7 +21,7 @@ This program monitors the SGD to MYR exchange rate from the CIMB Clicks website.
 - Sends WhatsApp notifications when the rate goes outside the specified range.
 - Allows restarting the program with a key press or CTRL+C.
 
-The program uses Chrome in headless mode for web scraping and the WhatsApp API for sending notifications. It's designed to run continuously to provide real-time updates on the exchange rate.
+The program reads the rate page over plain HTTP, falling back to Chrome in headless mode when the page cannot be parsed, and uses the WhatsApp API for sending notifications. It's designed to run continuously to provide real-time updates on the exchange rate.
 `
 }
 
@@ -34,13 +34,14 @@ func helpInfo() {
    - Choose to list joined WhatsApp groups or start the monitoring program.
 
 2. **Starting the Program:**
-   - Set your desired minimum and maximum exchange rates.
-   - Specify a WhatsApp target for notifications:
+   - Choose the currency pairs to monitor (e.g. SGD/MYR,SGD/IDR,SGD/INR,MYR/SGD).
+   - Set your desired minimum and maximum exchange rates for each pair.
+   - Specify one or more WhatsApp targets for notifications, separated by commas:
      - **For personal notifications, enter a phone number including the country code without the `+` sign (e.g., 60123456789).** Ensure the number starts with the country code followed directly by the phone number.
      - For group notifications, enter the group name or ID as listed in the joined groups.
 
 3. **Monitoring:**
-   - The program fetches the exchange rate every 40 - 70 seconds and displays it with color coding based on the rate's change.
+   - The program fetches the exchange rate about every minute (45 - 75 seconds by default, slower outside the configured active hours and faster near a threshold) and displays it with color coding based on the rate's change.
 
 4. **Notifications:**
    - Notifications are sent via WhatsApp when the rate falls outside the defined range.
@@ -80,7 +81,9 @@ func printAppInfo() {
 	fmt.Println()
 }
 
-func printColoredRate(currentRate, prevRate float64) {
+// printColoredRate prints the rate, followed by transfer (what the
+// configured amount gets) when it is not empty.
+func printColoredRate(pair *CurrencyPair, currentRate, prevRate float64, transfer string) {
 	currentTime := time.Now().Format("2006-01-02 15:04:05")
 	var colorFunc func(format string, a ...interface{}) string
 
@@ -95,10 +98,12 @@ func printColoredRate(currentRate, prevRate float64) {
 		colorFunc = color.New(color.FgWhite).SprintfFunc()
 	}
 
-	fmt.Println(colorFunc("%s : Rate : SGD 1.00 = MYR %.4f", currentTime, currentRate))
+	line := colorFunc("%s : Rate : %s 1.00 = %s %.4f", currentTime, pair.From, pair.To, currentRate)
+	if pair.Derived != nil {
+		line += colorFunc(" (derived, %s)", pair.Derived.description)
+	}
+	if transfer != "" {
+		line += colorFunc(" : %s", transfer)
+	}
+	fmt.Println(line)
 }
-
-func shouldNotify(currentRate float64, config *Config) bool {
-	return (currentRate <= config.DesiredMinRate || currentRate >= config.DesiredMaxRate) &&
-		currentRate != config.LastNotifiedRate
-}
\ No newline at end of file
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// TelegramNotifier sends alerts through the Telegram Bot API. The target is
+// the chat ID, e.g. "telegram:123456789"; ChatID is used for a bare
+// "telegram:" target. APIURL only needs setting to use a stand-in server.
+type TelegramNotifier struct {
+	Token  string `json:"token"`
+	ChatID string `json:"chat_id,omitempty"`
+	APIURL string `json:"api_url,omitempty"`
+}
+
+func (t *TelegramNotifier) Name() string {
+	return notifierTelegram
+}
+
+func (t *TelegramNotifier) prepare() error {
+	if t.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if t.APIURL == "" {
+		t.APIURL = "https://api.telegram.org"
+	}
+	t.APIURL = strings.TrimSuffix(t.APIURL, "/")
+	return nil
+}
+
+func (t *TelegramNotifier) Notify(ctx context.Context, n Notification) error {
+	chatID := n.Target
+	if chatID == "" {
+		chatID = t.ChatID
+	}
+	if chatID == "" {
+		return fmt.Errorf("no chat ID")
+	}
+
+	body := map[string]string{"chat_id": chatID, "text": n.Message}
+	resp, err := postJSON(ctx, t.APIURL+"/bot"+t.Token+"/sendMessage", body, nil)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return fmt.Errorf("error decoding Telegram response: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram: %s", result.Description)
+	}
+	return nil
+}
+
+// SlackNotifier posts alerts to a Slack incoming webhook. A target such as
+// "slack:https://hooks.slack.com/services/..." posts to that webhook;
+// WebhookURL is used for a bare "slack:" target.
+type SlackNotifier struct {
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+func (s *SlackNotifier) Name() string {
+	return notifierSlack
+}
+
+func (s *SlackNotifier) prepare() error {
+	return nil
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	url := s.WebhookURL
+	if n.Target != "" {
+		url = n.Target
+	}
+	if url == "" {
+		return fmt.Errorf("no webhook URL")
+	}
+	_, err := postJSON(ctx, url, map[string]string{"text": n.Message}, nil)
+	return err
+}
+
+// WebhookNotifier posts each alert as a JSON Notification to URL, or to the
+// URL given in the target ("webhook:https://..."), with any extra Headers
+// (e.g. an Authorization token).
+type WebhookNotifier struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (w *WebhookNotifier) Name() string {
+	return notifierWebhook
+}
+
+func (w *WebhookNotifier) prepare() error {
+	if w.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	return nil
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	url := w.URL
+	if n.Target != "" {
+		url = n.Target
+		n.Target = ""
+	}
+	_, err := postJSON(ctx, url, n, w.Headers)
+	return err
+}
+
+// postJSON posts body as JSON to url and returns the response body, failing
+// on any non-2xx status. Errors leave out url, which may hold a secret such
+// as a bot token or a webhook's key, as they are logged and stored.
+func postJSON(ctx context.Context, url string, body interface{}, headers map[string]string) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", redactURL(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := notifierHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error posting notification: %v", redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if detail := strings.TrimSpace(string(respBody)); detail != "" {
+			return nil, fmt.Errorf("unexpected status posting notification: %s: %s", resp.Status, detail)
+		}
+		return nil, fmt.Errorf("unexpected status posting notification: %s", resp.Status)
+	}
+	return respBody, nil
+}
+
+// redactURL returns the cause of a *url.Error without the URL.
+func redactURL(err error) error {
+	var uerr *neturl.Error
+	if errors.As(err, &uerr) {
+		return uerr.Err
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// request is what a stand-in server received.
+type request struct {
+	method, path string
+	header       http.Header
+	body         []byte
+}
+
+// standIn starts a server that records each request and answers with status
+// and response.
+func standIn(t *testing.T, status int, response string) (*httptest.Server, *[]request) {
+	t.Helper()
+	var received []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, request{r.Method, r.URL.Path, r.Header.Clone(), body})
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &received
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	srv, received := standIn(t, http.StatusOK, `{"ok": true}`)
+	telegram := &TelegramNotifier{Token: "123:abc", ChatID: "42", APIURL: srv.URL + "/"}
+	if err := telegram.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := telegram.Notify(context.Background(), Notification{Message: "Alert"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := (*received)[0]
+	if r.method != http.MethodPost || r.path != "/bot123:abc/sendMessage" {
+		t.Errorf("request %s %s, want POST /bot123:abc/sendMessage", r.method, r.path)
+	}
+	if ct := r.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q, want application/json", ct)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(r.body, &body); err != nil || body["chat_id"] != "42" || body["text"] != "Alert" {
+		t.Errorf("body %s, want chat_id 42 and text Alert", r.body)
+	}
+
+	if err := telegram.Notify(context.Background(), Notification{Target: "7", Message: "Alert"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal((*received)[1].body, &body); err != nil || body["chat_id"] != "7" {
+		t.Errorf("body %s, want the target's chat_id 7", (*received)[1].body)
+	}
+}
+
+func TestTelegramNotifierErrors(t *testing.T) {
+	srv, _ := standIn(t, http.StatusOK, `{"ok": false, "description": "chat not found"}`)
+	telegram := &TelegramNotifier{Token: "123:abc", ChatID: "42", APIURL: srv.URL}
+	err := telegram.Notify(context.Background(), Notification{Message: "Alert"})
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("ok:false gave %v, want the description", err)
+	}
+
+	srv, _ = standIn(t, http.StatusUnauthorized, `{"ok": false, "description": "Unauthorized"}`)
+	telegram.APIURL = srv.URL
+	if err := telegram.Notify(context.Background(), Notification{Message: "Alert"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("401 gave %v, want an error with the status", err)
+	}
+
+	if err := (&TelegramNotifier{Token: "123:abc", APIURL: srv.URL}).Notify(context.Background(), Notification{Message: "Alert"}); err == nil {
+		t.Error("no chat ID gave no error")
+	}
+}
+
+func TestTelegramNotifierHidesToken(t *testing.T) {
+	srv, _ := standIn(t, http.StatusOK, `{"ok": true}`)
+	srv.Close()
+	telegram := &TelegramNotifier{Token: "123:secret", ChatID: "42", APIURL: srv.URL}
+	err := telegram.Notify(context.Background(), Notification{Message: "Alert"})
+	if err == nil {
+		t.Fatal("closed server gave no error")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q shows the bot token", err)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	srv, received := standIn(t, http.StatusOK, "ok")
+	slack := &SlackNotifier{WebhookURL: srv.URL + "/services/T0/B0/x"}
+	if err := slack.Notify(context.Background(), Notification{Message: "Alert"}); err != nil {
+		t.Fatal(err)
+	}
+	r := (*received)[0]
+	if r.path != "/services/T0/B0/x" || r.header.Get("Content-Type") != "application/json" || string(r.body) != `{"text":"Alert"}` {
+		t.Errorf("request %s %s %s, want the message posted as JSON to the webhook", r.path, r.header.Get("Content-Type"), r.body)
+	}
+
+	if err := (&SlackNotifier{}).prepare(); err != nil {
+		t.Errorf("no webhook_url gave %v, want it optional for per-target webhooks", err)
+	}
+	if err := (&SlackNotifier{}).Notify(context.Background(), Notification{Target: srv.URL + "/target", Message: "Alert"}); err != nil {
+		t.Fatal(err)
+	}
+	if r := (*received)[1]; r.path != "/target" {
+		t.Errorf("posted to %s, want the target's /target", r.path)
+	}
+	if err := (&SlackNotifier{}).Notify(context.Background(), Notification{Message: "Alert"}); err == nil {
+		t.Error("bare target without webhook_url gave no error")
+	}
+
+	srv, _ = standIn(t, http.StatusNotFound, "no_service")
+	err := (&SlackNotifier{WebhookURL: srv.URL}).Notify(context.Background(), Notification{Message: "Alert"})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no_service") {
+		t.Errorf("404 gave %v, want the status and response", err)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	srv, received := standIn(t, http.StatusNoContent, "")
+	webhook := &WebhookNotifier{URL: srv.URL + "/default", Headers: map[string]string{"Authorization": "Bearer secret"}}
+	n := Notification{Target: srv.URL + "/hook", Message: "Alert", Rule: "range", Pair: "SGD/MYR", Rate: 3.45}
+	if err := webhook.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	r := (*received)[0]
+	if r.path != "/hook" {
+		t.Errorf("posted to %s, want the target's /hook", r.path)
+	}
+	if auth := r.header.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("Authorization %q, want the configured header", auth)
+	}
+	var got Notification
+	if err := json.Unmarshal(r.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Target != "" || got.Message != "Alert" || got.Rule != "range" || got.Pair != "SGD/MYR" || got.Rate != 3.45 {
+		t.Errorf("body %s, want the notification without its target", r.body)
+	}
+
+	srv, _ = standIn(t, http.StatusInternalServerError, "")
+	webhook.URL = srv.URL
+	if err := webhook.Notify(context.Background(), Notification{Message: "Alert"}); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("500 gave %v, want an error with the status", err)
+	}
+}
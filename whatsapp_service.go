@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -16,19 +17,15 @@ import (
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
 	"google.golang.org/protobuf/proto"
-
-	_ "modernc.org/sqlite"
 )
 
-func setupWhatsAppClient(config *Config) error {
+func setupWhatsAppClient(ctx context.Context, config *Config) error {
 	dbLog := waLog.Stdout("Database", "ERROR", true)
 	clientLog := waLog.Stdout("Client", "ERROR", true)
 
-	dbString := "file:whatsapp.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
-
-	container, err := sqlstore.New("sqlite", dbString, dbLog)
-	if err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
+	container := sqlstore.NewWithDB(config.DB, "sqlite", dbLog)
+	if err := container.Upgrade(); err != nil {
+		return fmt.Errorf("failed to upgrade database: %v", err)
 	}
 
 	deviceStore, err := container.GetFirstDevice()
@@ -38,12 +35,12 @@ func setupWhatsAppClient(config *Config) error {
 
 	config.Client = whatsmeow.NewClient(deviceStore, clientLog)
 	config.Client.AddEventHandler(func(evt interface{}) {
-		eventHandler(evt, config)
+		eventHandler(ctx, evt, config)
 	})
 
 	if config.Client.Store.ID == nil {
 		// No ID stored, new login
-		if err := qrLogin(config.Client); err != nil {
+		if err := qrLogin(ctx, config.Client); err != nil {
 			return fmt.Errorf("error during QR login: %v", err)
 		}
 	} else {
@@ -53,13 +50,13 @@ func setupWhatsAppClient(config *Config) error {
 		}
 	}
 
-	config.Connected = true
+	config.Connected.Store(true)
 	logger.Println("Connected successfully to WhatsApp!")
 	return nil
 }
 
-func qrLogin(client *whatsmeow.Client) error {
-	qrChan, _ := client.GetQRChannel(context.Background())
+func qrLogin(ctx context.Context, client *whatsmeow.Client) error {
+	qrChan, _ := client.GetQRChannel(ctx)
 	err := client.Connect()
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
@@ -81,33 +78,39 @@ func qrLogin(client *whatsmeow.Client) error {
 	return nil
 }
 
-func eventHandler(evt interface{}, config *Config) {
+func eventHandler(ctx context.Context, evt interface{}, config *Config) {
 	switch v := evt.(type) {
 	case *events.Connected:
 		//logger.Println("Connected to WhatsApp")
-		config.Connected = true
+		config.Connected.Store(true)
 	case *events.Disconnected:
 		logger.Println("Disconnected from WhatsApp")
-		config.Connected = false
+		config.Connected.Store(false)
 		// Attempt to reconnect
 		go func() {
-			for !config.Connected {
+			for !config.Connected.Load() {
 				logger.Println("Attempting to reconnect...")
 				err := config.Client.Connect()
 				if err != nil {
 					logger.Printf("Failed to reconnect: %v", err)
-					time.Sleep(5 * time.Second)
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(5 * time.Second):
+					}
 				} else {
 					logger.Println("Reconnected successfully")
-					config.Connected = true
+					config.Connected.Store(true)
 				}
 			}
 		}()
+	case *events.Message:
+		go handleBotMessage(ctx, config, v)
 	case *events.LoggedOut:
 		logger.Println("Device logged out")
-		config.Connected = false
+		config.Connected.Store(false)
 		// Prompt for new login
-		err := qrLogin(config.Client)
+		err := qrLogin(ctx, config.Client)
 		if err != nil {
 			logger.Printf("Failed to login with QR: %v", err)
 		}
@@ -116,55 +119,82 @@ func eventHandler(evt interface{}, config *Config) {
 	}
 }
 
-func sendWhatsAppNotification(config *Config, rate float64) {
-	if !config.Connected {
-		logger.Println("WhatsApp client not connected. Skipping notification.")
-		return
+// sendWhatsAppNotification sends message to target, one of the configured
+// NotifyTargets or a phone number, group name or group ID given by an alert
+// rule.
+func sendWhatsAppNotification(ctx context.Context, config *Config, target, message string) error {
+	if !config.Connected.Load() {
+		whatsappNotifications.Inc("skipped")
+		return fmt.Errorf("WhatsApp client not connected")
 	}
 
-	var recipient types.JID
-	if config.IsGroup {
-		matchedGroupID, err := matchGroupID(config.Client, config.NotifyTarget)
-		if err != nil {
-			logger.Printf("Error matching group ID: %v", err)
-			return
-		}
-		// Ensure the group ID is in the correct format
-		trimmedID := strings.TrimSuffix(matchedGroupID, "@g.us")
-		recipient = types.NewJID(trimmedID, types.GroupServer)
-	} else {
-		recipient = types.NewJID(config.NotifyTarget, types.DefaultUserServer)
+	recipient, err := config.recipient(target)
+	if err != nil {
+		whatsappNotifications.Inc("failed")
+		return err
 	}
 
-	message := fmt.Sprintf("Alert: The current rate is SGD 1.00 = MYR %.4f", rate)
-	msg := &waProto.Message{Conversation: proto.String(message)}
+	return sendWhatsAppMessage(ctx, config, recipient, message)
+}
 
-	maxRetries := 3
-	retryDelay := time.Second * 5
+// sendWhatsAppImage sends a PNG image with a caption to target.
+func sendWhatsAppImage(ctx context.Context, config *Config, target string, image []byte, caption string) error {
+	if !config.Connected.Load() {
+		whatsappNotifications.Inc("skipped")
+		return fmt.Errorf("WhatsApp client not connected")
+	}
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		_, err := config.Client.SendMessage(context.Background(), recipient, msg)
-		if err == nil {
-			logger.Println("WhatsApp notification sent successfully")
-			return
-		}
+	recipient, err := config.recipient(target)
+	if err != nil {
+		whatsappNotifications.Inc("failed")
+		return err
+	}
 
-		logger.Printf("Attempt %d failed: %v. Retrying in %v...", attempt+1, err, retryDelay)
-		time.Sleep(retryDelay)
+	msg, err := imageMessage(ctx, config.Client, image, caption)
+	if err == nil {
+		_, err = config.Client.SendMessage(ctx, recipient, msg)
+	}
+	if err != nil {
+		whatsappNotifications.Inc("failed")
+		return fmt.Errorf("failed to send WhatsApp image: %v", err)
 	}
+	logger.Println("WhatsApp image sent successfully")
+	whatsappNotifications.Inc("sent")
+	return nil
+}
 
-	logger.Printf("Failed to send WhatsApp message after %d attempts", maxRetries)
-	
-    // If all attempts fail, try sending to yourself as a fallback
-	if config.IsGroup {
-		selfJID := config.Client.Store.ID.ToNonAD()
-		_, err := config.Client.SendMessage(context.Background(), selfJID, msg)
-		if err != nil {
-			logger.Printf("Failed to send fallback message to self: %v", err)
-		} else {
-			logger.Println("Fallback message sent to self successfully")
-		}
+// imageMessage uploads a PNG image and returns the message that shows it.
+func imageMessage(ctx context.Context, client *whatsmeow.Client, image []byte, caption string) (*waProto.Message, error) {
+	uploaded, err := client.Upload(ctx, image, whatsmeow.MediaImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload image: %v", err)
 	}
+	return &waProto.Message{ImageMessage: &waProto.ImageMessage{
+		Caption:       proto.String(caption),
+		Mimetype:      proto.String("image/png"),
+		URL:           proto.String(uploaded.URL),
+		DirectPath:    proto.String(uploaded.DirectPath),
+		MediaKey:      uploaded.MediaKey,
+		FileEncSHA256: uploaded.FileEncSHA256,
+		FileSHA256:    uploaded.FileSHA256,
+		FileLength:    proto.Uint64(uploaded.FileLength),
+		Width:         proto.Uint32(chartWidth),
+		Height:        proto.Uint32(chartHeight),
+	}}, nil
+}
+
+// sendWhatsAppMessage makes one attempt to send message to recipient.
+// Retries are left to the outbox.
+func sendWhatsAppMessage(ctx context.Context, config *Config, recipient types.JID, message string) error {
+	msg := &waProto.Message{Conversation: proto.String(message)}
+
+	if _, err := config.Client.SendMessage(ctx, recipient, msg); err != nil {
+		whatsappNotifications.Inc("failed")
+		return fmt.Errorf("failed to send WhatsApp message: %v", err)
+	}
+	logger.Println("WhatsApp notification sent successfully")
+	whatsappNotifications.Inc("sent")
+	return nil
 }
 
 func listJoinedGroups(config *Config) {
@@ -221,27 +251,122 @@ func extractGroupIDFromLink(link string) string {
 func setupWhatsAppPreferences(config *Config) {
 	scanner := bufio.NewScanner(os.Stdin)
 
-	fmt.Println("Enter WhatsApp target:")
+	fmt.Println("Enter WhatsApp targets, separated by commas:")
 	fmt.Println("- For personal notifications, enter a phone number (e.g., 60123456789)")
 	fmt.Println("- For group notifications, enter the group name or group ID")
 	fmt.Print("Your input: ")
 	scanner.Scan()
-	config.NotifyTarget = strings.TrimSpace(scanner.Text())
+	config.NotifyTargets = splitTargets(scanner.Text())
+
+	if err := resolveTargets(config); err != nil {
+		logger.Printf("Error: %v", err)
+	}
+}
 
-	config.IsGroup = isGroupIdentifier(config.NotifyTarget)
+// splitTargets splits a comma-separated list of targets.
+func splitTargets(s string) []string {
+	var targets []string
+	for _, target := range strings.Split(s, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// resolveTarget turns a target into the JID messages are sent to. A group
+// name or ID must match a group this account has joined; a phone number must
+// be registered on WhatsApp.
+func resolveTarget(client *whatsmeow.Client, target string) (types.JID, error) {
+	// A full user JID, such as a subscriber's, needs no lookup
+	if jid, err := types.ParseJID(target); err == nil && jid.Server == types.DefaultUserServer {
+		return jid, nil
+	}
 
-	if config.IsGroup {
-		matchedGroupID, err := matchGroupID(config.Client, config.NotifyTarget)
+	if isGroupIdentifier(target) {
+		matchedGroupID, err := matchGroupID(client, target)
 		if err != nil {
-			logger.Printf("Error: %v\n", err)
-			logger.Println("Setting target to personal WhatsApp number.")
-			config.IsGroup = false
+			return types.JID{}, err
+		}
+		return types.NewJID(matchedGroupID, types.GroupServer), nil
+	}
+
+	number := strings.TrimPrefix(target, "+")
+	resp, err := client.IsOnWhatsApp([]string{"+" + number})
+	if err != nil {
+		return types.JID{}, fmt.Errorf("failed to check %s on WhatsApp: %v", target, err)
+	}
+	if len(resp) == 0 || !resp[0].IsIn {
+		return types.JID{}, fmt.Errorf("%s is not on WhatsApp", target)
+	}
+	return resp[0].JID, nil
+}
+
+// resolveTargets resolves every notification target, the configured ones and
+// those of the alert rules, once at startup so a mistyped number or group
+// name is reported before the first alert. All failures are returned
+// together.
+func resolveTargets(config *Config) error {
+	targets := append([]string(nil), config.NotifyTargets...)
+	for _, rule := range config.Rules {
+		targets = append(targets, rule.Targets...)
+	}
+	for _, digest := range config.Digests {
+		targets = append(targets, digest.Targets...)
+	}
+
+	resolved := make(map[string]types.JID)
+	var errs []error
+	for _, target := range targets {
+		kind, address := splitTarget(target)
+		if kind != notifierWhatsApp {
+			// Other notifiers have nothing to look up, but must be set up.
+			if config.Notifiers[kind] == nil {
+				errs = append(errs, fmt.Errorf("target %s: no %s notifier configured", target, kind))
+			}
+			continue
+		}
+		if _, ok := resolved[address]; ok {
+			continue
+		}
+		jid, err := resolveTarget(config.Client, address)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resolved[address] = jid
+		if jid.Server == types.GroupServer {
+			logger.Printf("Target %s: WhatsApp group %s", address, jid)
 		} else {
-			config.NotifyTarget = matchedGroupID
-			logger.Printf("Matched group ID: %s\n", config.NotifyTarget)
-			logger.Println("Target set to WhatsApp group")
+			logger.Printf("Target %s: WhatsApp number %s", address, jid.User)
 		}
-	} else {
-		logger.Println("Target set to personal WhatsApp number:", config.NotifyTarget)
 	}
-}
\ No newline at end of file
+
+	config.mu.Lock()
+	config.recipients = resolved
+	config.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// recipient returns the JID target was resolved to, resolving it now if it
+// was not known at startup.
+func (c *Config) recipient(target string) (types.JID, error) {
+	c.mu.RLock()
+	jid, ok := c.recipients[target]
+	c.mu.RUnlock()
+	if ok {
+		return jid, nil
+	}
+
+	jid, err := resolveTarget(c.Client, target)
+	if err != nil {
+		return types.JID{}, err
+	}
+	c.mu.Lock()
+	if c.recipients == nil {
+		c.recipients = make(map[string]types.JID)
+	}
+	c.recipients[target] = jid
+	c.mu.Unlock()
+	return jid, nil
+}